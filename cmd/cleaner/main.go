@@ -2,12 +2,18 @@
 // from the different sections in the book. If these chunks are over 500 words,
 // then it breaks those up into 250 word chunks. Each chunk exists on it's own
 // line and vectorized.
+//
+// The program also writes every section in full along with small child chunks
+// of whole sentences that reference the section they came from. Searching the
+// child chunks gives a precise match, and the section or the neighboring
+// chunks give the model the full context.
 // NOTE:
 // More needs to be done. Code examples are flattened out as an example.
 package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -16,6 +22,7 @@ import (
 	"strings"
 
 	"code.sajari.com/docconv/v2"
+	"github.com/ardanlabs/ai-training/foundation/mongodb"
 )
 
 func main() {
@@ -74,6 +81,7 @@ func findChunks() error {
 	input := string(inputB)
 
 	var chunks []string
+	var titles []string
 
 	for i := 0; i < len(sections); i++ {
 		strSection := sections[i]
@@ -84,6 +92,7 @@ func findChunks() error {
 		endSection := sections[i+1]
 
 		srtIdx := strings.Index(input, strSection+"\n")
+		titles = append(titles, strSection)
 
 		switch {
 		case endSection != "END":
@@ -147,6 +156,140 @@ func findChunks() error {
 		}
 	}
 
+	// -------------------------------------------------------------------------
+
+	// This code writes the sections in full and breaks them into small child
+	// chunks that reference their section.
+
+	if err := writeSections(titles, chunks); err != nil {
+		return fmt.Errorf("writeSections: %w", err)
+	}
+
+	return nil
+}
+
+// childWords is the maximum number of words in a child chunk. Sentences are
+// kept whole unless a single sentence is longer than this.
+const childWords = 64
+
+func writeSections(titles []string, chunks []string) error {
+	nonAlphanumericRegex := regexp.MustCompile(`[^\p{L}\p{N} ]+`)
+
+	sectionsFile, err := os.Create("zarf/data/book.sections")
+	if err != nil {
+		return fmt.Errorf("create sections file: %w", err)
+	}
+	defer sectionsFile.Close()
+
+	childrenFile, err := os.Create("zarf/data/book.children")
+	if err != nil {
+		return fmt.Errorf("create children file: %w", err)
+	}
+	defer childrenFile.Close()
+
+	sectionsEnc := json.NewEncoder(sectionsFile)
+	childrenEnc := json.NewEncoder(childrenFile)
+
+	var childID int
+
+	for i, chunk := range chunks {
+		sectionID := i + 1
+
+		// Split the section into sentences before the punctuation is removed.
+		var sentences [][]string
+		var sentence []string
+
+		for _, word := range strings.Fields(chunk) {
+			sentence = append(sentence, word)
+
+			if strings.HasSuffix(word, ".") || strings.HasSuffix(word, "?") || strings.HasSuffix(word, "!") {
+				sentences = append(sentences, sentence)
+				sentence = nil
+			}
+		}
+
+		if len(sentence) > 0 {
+			sentences = append(sentences, sentence)
+		}
+
+		// Clean the words in each sentence the same way as the chunks.
+		var sectionWords []string
+		for j, sentence := range sentences {
+			var cleaned []string
+			for _, word := range sentence {
+				word = nonAlphanumericRegex.ReplaceAllString(word, "")
+				if word != "" {
+					cleaned = append(cleaned, word)
+				}
+			}
+
+			sentences[j] = cleaned
+			sectionWords = append(sectionWords, cleaned...)
+		}
+
+		section := mongodb.Section{
+			ID:    sectionID,
+			Title: titles[i],
+			Text:  strings.Join(sectionWords, " "),
+		}
+
+		if err := sectionsEnc.Encode(section); err != nil {
+			return fmt.Errorf("encode section: %w", err)
+		}
+
+		// Pack whole sentences into child chunks.
+		var seq int
+		var words []string
+
+		flush := func() error {
+			if len(words) == 0 {
+				return nil
+			}
+
+			childID++
+
+			child := mongodb.Chunk{
+				ID:        childID,
+				SectionID: sectionID,
+				Seq:       seq,
+				Text:      strings.Join(words, " "),
+			}
+
+			if err := childrenEnc.Encode(child); err != nil {
+				return fmt.Errorf("encode child: %w", err)
+			}
+
+			seq++
+			words = nil
+
+			return nil
+		}
+
+		for _, sentence := range sentences {
+			if len(words)+len(sentence) > childWords {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+			// A single sentence over the limit is split on the limit.
+			for len(sentence) > childWords {
+				words = sentence[:childWords]
+				if err := flush(); err != nil {
+					return err
+				}
+
+				sentence = sentence[childWords:]
+			}
+
+			words = append(words, sentence...)
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
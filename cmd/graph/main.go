@@ -0,0 +1,167 @@
+// This program builds a knowledge graph from the book collection. Each chunk
+// is sent to the LLM to extract the Go concepts it mentions and how they
+// relate. The entities and relations are stored in their own collections and
+// link back to the chunk ids, so a retriever can walk from the chunks found
+// by a vector search to related concepts in other chapters.
+//
+// Chunks that already have an extraction are skipped, so the program can be
+// stopped and restarted.
+//
+// # Running the program:
+//
+//	$ make graph
+//
+// # This requires running the following commands:
+//
+//	$ make dev-up   // This starts the mongodb and ollama service in docker compose.
+//	$ make example6 // This loads the book collection.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/mongodb"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	model := flag.String("model", "llama3", "name of the ollama model used for extraction")
+	dbName := flag.String("db", "example5", "name of the database")
+	collectionName := flag.String("collection", "book", "name of the collection")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+
+	// Load the mongodb settings. The defaults point to the local environment
+	// and can be overridden with MONGO_* environment variables or a config
+	// file named by MONGO_CONFIG_FILE.
+	cfg, err := mongodb.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
+	}
+
+	// Connect to mongodb.
+	client, err := mongodb.ConnectWithConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("connectToMongo: %w", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database(*dbName)
+	col := db.Collection(*collectionName)
+
+	graph, err := mongodb.NewGraphStore(db.Collection("entities"), db.Collection("relations"), db.Collection("extractions"))
+	if err != nil {
+		return fmt.Errorf("newGraphStore: %w", err)
+	}
+
+	if err := graph.CreateIndexes(ctx); err != nil {
+		return fmt.Errorf("createIndexes: %w", err)
+	}
+
+	// Ask ollama for JSON so the extraction can be parsed.
+	llm, err := ollama.New(ollama.WithModel(*model), ollama.WithFormat("json"))
+	if err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	// -------------------------------------------------------------------------
+	// Extract the entities and relations from every chunk.
+
+	var extracted, skipped, failed int
+
+	// The chunks are read a page at a time, so no cursor is left open while
+	// the LLM works through a page and the server can't time it out.
+	lastID := -1
+
+	for {
+		chunks, err := readChunks(ctx, col, lastID, 50)
+		if err != nil {
+			return fmt.Errorf("readChunks: %w", err)
+		}
+
+		if len(chunks) == 0 {
+			break
+		}
+
+		lastID = chunks[len(chunks)-1].ID
+
+		for _, chunk := range chunks {
+			done, err := graph.Extracted(ctx, chunk.ID)
+			if err != nil {
+				return fmt.Errorf("extracted: %w", err)
+			}
+
+			if done {
+				skipped++
+				continue
+			}
+
+			fmt.Printf("Extracting Chunk: %d\n", chunk.ID)
+
+			ext, err := mongodb.ExtractGraph(ctx, llm, chunk.Text)
+			if err != nil {
+				// A model can return malformed output for a chunk, which
+				// shouldn't stop the rest of the book.
+				fmt.Printf("  chunk %d: %s\n", chunk.ID, err)
+				failed++
+				continue
+			}
+
+			if err := graph.Save(ctx, chunk.ID, ext); err != nil {
+				return fmt.Errorf("save: %w", err)
+			}
+
+			fmt.Printf("  entities[%d] relations[%d]\n", len(ext.Entities), len(ext.Relations))
+			extracted++
+		}
+	}
+
+	fmt.Printf("Graph Built: extracted[%d] skipped[%d] failed[%d]\n", extracted, skipped, failed)
+
+	return nil
+}
+
+type bookChunk struct {
+	ID   int    `bson:"id"`
+	Text string `bson:"text"`
+}
+
+// readChunks returns the next page of chunks with an id after the specified
+// id, in id order.
+func readChunks(ctx context.Context, col *mongo.Collection, afterID int, limit int64) ([]bookChunk, error) {
+	filter := bson.D{{Key: "id", Value: bson.D{{Key: "$gt", Value: afterID}}}}
+	projection := bson.D{{Key: "id", Value: 1}, {Key: "text", Value: 1}}
+
+	opts := options.Find().
+		SetProjection(projection).
+		SetSort(bson.D{{Key: "id", Value: 1}}).
+		SetLimit(limit)
+
+	cur, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var chunks []bookChunk
+	if err := cur.All(ctx, &chunks); err != nil {
+		return nil, fmt.Errorf("all: %w", err)
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,112 @@
+// This program re-embeds the book collection with a new embedding model. The
+// new embeddings are written to a shadow field with a new vector index. Once
+// every document is embedded and the index is queryable, readers using the
+// embeddings registry are switched over to the new model.
+//
+// # Running the program:
+//
+//	$ make migrate MODEL=nomic-embed-text DIMS=768 VERSION=1 PATH_NAME=embedding_nomic
+//
+// # This requires running the following command:
+//
+//	$ make dev-up // This starts the mongodb and ollama service in docker compose.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/mongodb"
+	"github.com/tmc/langchaingo/llms/ollama"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	model := flag.String("model", "", "name of the ollama embedding model")
+	dims := flag.Int("dims", 0, "number of dimensions produced by the model")
+	version := flag.Int("version", 1, "version of the embeddings")
+	path := flag.String("path", "", "shadow field to write the new embeddings to")
+	index := flag.String("index", "", "name of the new vector index")
+	dbName := flag.String("db", "example5", "name of the database")
+	collectionName := flag.String("collection", "book", "name of the collection")
+	flag.Parse()
+
+	if *model == "" || *dims <= 0 || *path == "" {
+		flag.Usage()
+		return fmt.Errorf("model, dims and path are required")
+	}
+
+	indexName := *index
+	if indexName == "" {
+		indexName = *path + "_index"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	// Open a connection with ollama to access the new model.
+	llm, err := ollama.New(ollama.WithModel(*model))
+	if err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	// Load the mongodb settings. The defaults point to the local environment
+	// and can be overridden with MONGO_* environment variables or a config
+	// file named by MONGO_CONFIG_FILE.
+	mongoCfg, err := mongodb.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
+	}
+
+	fmt.Println("Connecting to MongoDB:", mongoCfg)
+
+	// Connect to mongodb.
+	client, err := mongodb.ConnectWithConfig(ctx, mongoCfg)
+	if err != nil {
+		return fmt.Errorf("connectToMongo: %w", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database(*dbName)
+
+	cfg := mongodb.MigrationConfig{
+		Collection: db.Collection(*collectionName),
+		Registry:   db.Collection("embeddings"),
+		Embedder:   llm,
+		Target: mongodb.EmbeddingTarget{
+			Model: mongodb.EmbeddingModel{
+				Name:       *model,
+				Dimensions: *dims,
+				Version:    *version,
+			},
+			Path:      *path,
+			IndexName: indexName,
+		},
+		Similarity: "cosine",
+		TextKey:    "text",
+		Progress: func(embedded int) {
+			fmt.Print("\033[u\033[K")
+			fmt.Printf("Re-embedding Data: %d", embedded)
+		},
+	}
+
+	fmt.Print("\n")
+	fmt.Print("\033[s")
+
+	if err := mongodb.MigrateEmbeddings(ctx, cfg); err != nil {
+		return fmt.Errorf("migrateEmbeddings: %w", err)
+	}
+
+	fmt.Print("\n")
+	fmt.Printf("Readers switched to %s (v%d) at %q\n", *model, *version, *path)
+
+	return nil
+}
@@ -0,0 +1,160 @@
+// This program keeps an embeddings JSONL file and the book collection in
+// sync. By default the file is the source of truth: the collection is diffed
+// against the file by id and content hash and the required inserts, updates
+// and deletes are applied. With -export the collection is written back to
+// the file, so a file can serve as a reproducible snapshot of the index.
+//
+// # Running the program:
+//
+//	$ make sync           // Apply zarf/data/book.embeddings to the collection.
+//	$ make sync-dry-run   // Report the changes without applying them.
+//	$ make sync-export    // Write the collection to zarf/data/book.embeddings.
+//
+// # This requires running the following command:
+//
+//	$ make dev-up // This starts the mongodb service in docker compose.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	file := flag.String("file", "zarf/data/book.embeddings", "embeddings JSONL file")
+	dryRun := flag.Bool("dry-run", false, "report the changes without applying them")
+	export := flag.Bool("export", false, "write the collection to the file instead")
+	dbName := flag.String("db", "example5", "name of the database")
+	collectionName := flag.String("collection", "book", "name of the collection")
+	model := flag.String("model", "mxbai-embed-large", "model for records in the file that are not tagged")
+	dims := flag.Int("dims", 1024, "dimensions for records in the file that are not tagged")
+	version := flag.Int("version", 1, "version for records in the file that are not tagged")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// Load the mongodb settings. The defaults point to the local environment
+	// and can be overridden with MONGO_* environment variables or a config
+	// file named by MONGO_CONFIG_FILE.
+	cfg, err := mongodb.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
+	}
+
+	// Connect to mongodb.
+	client, err := mongodb.ConnectWithConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("connectToMongo: %w", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	col := client.Database(*dbName).Collection(*collectionName)
+
+	if *export {
+		return exportFile(ctx, col, *file)
+	}
+
+	defaultModel := mongodb.EmbeddingModel{
+		Name:       *model,
+		Dimensions: *dims,
+		Version:    *version,
+	}
+
+	return syncFile(ctx, col, *file, defaultModel, *dryRun)
+}
+
+func syncFile(ctx context.Context, col *mongo.Collection, file string, defaultModel mongodb.EmbeddingModel, dryRun bool) error {
+	input, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer input.Close()
+
+	records, err := mongodb.ReadEmbeddings(input)
+	if err != nil {
+		return fmt.Errorf("readEmbeddings: %w", err)
+	}
+
+	// Embeddings files written before model tagging existed were all
+	// produced by the default model.
+	for i := range records {
+		if records[i].Model.Name == "" {
+			records[i].Model = defaultModel
+		}
+	}
+
+	plan, err := mongodb.PlanSync(ctx, col, records)
+	if err != nil {
+		return fmt.Errorf("planSync: %w", err)
+	}
+
+	fmt.Println("Sync Plan:", plan)
+
+	if dryRun {
+		for _, rec := range plan.Inserts {
+			fmt.Printf("  insert: %d\n", rec.ID)
+		}
+
+		for _, rec := range plan.Updates {
+			fmt.Printf("  update: %d\n", rec.ID)
+		}
+
+		for _, id := range plan.Deletes {
+			fmt.Printf("  delete: %d\n", id)
+		}
+
+		return nil
+	}
+
+	if err := mongodb.ApplySync(ctx, col, plan); err != nil {
+		return fmt.Errorf("applySync: %w", err)
+	}
+
+	fmt.Println("Sync Applied")
+
+	return nil
+}
+
+func exportFile(ctx context.Context, col *mongo.Collection, file string) error {
+	// Write to a temporary file first so a failed export doesn't destroy
+	// the existing snapshot.
+	tmp := file + ".tmp"
+
+	output, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer os.Remove(tmp)
+	defer output.Close()
+
+	count, err := mongodb.ExportEmbeddings(ctx, col, output)
+	if err != nil {
+		return fmt.Errorf("exportEmbeddings: %w", err)
+	}
+
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("rename file: %w", err)
+	}
+
+	fmt.Printf("Exported %d records to %s\n", count, file)
+
+	return nil
+}
@@ -1,6 +1,9 @@
 // This example shows you how to train the word2vec model with your own content
 // and leverage the model's nearest neighbor support. It also shows you how to
-// use the cosine similarity algorithm to test similarity.
+// use the cosine similarity algorithm to test similarity, and how to store
+// review embeddings in a document model to find similar reviews. Phrases
+// like "battery life" are learned first and joined into one word, so they
+// get a vector of their own.
 //
 // # Running the example:
 //
@@ -17,24 +20,44 @@
 // # WARNING
 //
 // This example uses a C++ based dynamic library that implements the Google
-// word2vec model service. That dynamic library was pre-built by me. That
-// library can be found under `foundation/word2vec/libw2v/lib/libw2v.dylib`.
-// If you don't want to use that dynamic library, the instructions to build your
-// own version exists here: https://github.com/fogfish/word2vec
+// word2vec model service. The library is built from the sources under
+// `foundation/word2vec/libw2v` by `make libw2v`, which `make example3` runs
+// first, into `foundation/word2vec/libw2v/lib` (libw2v.dylib on macOS and
+// libw2v.so elsewhere). The original project is here:
+// https://github.com/fogfish/word2vec
+//
+// Testing the model uses the pure Go reader in `foundation/word2vec/purego`,
+// so a trained model file can be queried on machines without the library.
+//
+// # Evaluation Files:
+//
+// A CBOW and a Skip-Gram model are trained and both are scored with
+// `foundation/word2vec/eval`. zarf/data/wordsim.tsv holds word pairs from
+// the reviews scored by similarity, in the format of WordSim-353, and
+// zarf/data/questions-words.txt holds analogy questions in the format of
+// the original word2vec tool. Both are small fixtures for this corpus, the
+// full questions-words.txt is part of https://github.com/tmikolov/word2vec
+// and can replace the fixture, the words are compared without case.
 
 package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
 
 	"github.com/ardanlabs/ai-training/foundation/stopwords"
 	"github.com/ardanlabs/ai-training/foundation/vector"
 	"github.com/ardanlabs/ai-training/foundation/word2vec"
+	"github.com/ardanlabs/ai-training/foundation/word2vec/eval"
+	"github.com/ardanlabs/ai-training/foundation/word2vec/phrases"
+	"github.com/ardanlabs/ai-training/foundation/word2vec/purego"
 )
 
 func main() {
@@ -44,22 +67,47 @@ func main() {
 }
 
 func run() error {
-	if err := cleanData(); err != nil {
-		return fmt.Errorf("cleanData: %w", err)
+	// Ctrl-C stops the training threads cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	table, err := learnPhrases()
+	if err != nil {
+		return fmt.Errorf("learnPhrases: %w", err)
 	}
 
-	if err := trainModel(); err != nil {
+	model, err := trainModel(ctx, table, false, "zarf/data/example3.model")
+	if err != nil {
 		return fmt.Errorf("trainModel: %w", err)
 	}
+	defer model.Close()
 
-	if err := testModel(); err != nil {
+	// A Skip-Gram model is trained on the same corpus to compare it with
+	// the CBOW model, only its file is used.
+	sg, err := trainModel(ctx, table, true, "zarf/data/example3-sg.model")
+	if err != nil {
 		return fmt.Errorf("trainModel: %w", err)
 	}
+	sg.Close()
+
+	if err := testModel(table); err != nil {
+		return fmt.Errorf("testModel: %w", err)
+	}
+
+	if err := evaluateModels(); err != nil {
+		return fmt.Errorf("evaluateModels: %w", err)
+	}
+
+	if err := searchReviews(model, table); err != nil {
+		return fmt.Errorf("searchReviews: %w", err)
+	}
 
 	return nil
 }
 
-func cleanData() error {
+// cleanData streams the cleaned review text to the trainer, so no
+// intermediate file is written.
+func cleanData(yield func(sentence string) bool) error {
 	type document struct {
 		ReviewText string
 	}
@@ -70,12 +118,6 @@ func cleanData() error {
 	}
 	defer input.Close()
 
-	output, err := os.Create("zarf/data/example3.words")
-	if err != nil {
-		return fmt.Errorf("create file: %w", err)
-	}
-	defer output.Close()
-
 	var counter int
 
 	fmt.Print("\033[s")
@@ -92,8 +134,9 @@ func cleanData() error {
 
 		v := stopwords.Remove(d.ReviewText)
 
-		output.WriteString(v)
-		output.WriteString("\n")
+		if !yield(v) {
+			return nil
+		}
 
 		counter++
 
@@ -103,17 +146,50 @@ func cleanData() error {
 
 	fmt.Print("\n")
 
-	return nil
+	return scanner.Err()
+}
+
+func learnPhrases() (*phrases.Table, error) {
+	fmt.Println("Learning Phrases ...")
+	fmt.Print("\n")
+
+	config := phrases.NewConfigDefault()
+
+	table, err := phrases.Learn(cleanData, config)
+	if err != nil {
+		return nil, fmt.Errorf("learn: %w", err)
+	}
+
+	// The table is needed to rewrite queries the same way as the corpus.
+	if err := table.Save("zarf/data/example3.phrases"); err != nil {
+		return nil, fmt.Errorf("save: %w", err)
+	}
+
+	learned := table.Phrases()
+	fmt.Printf("Learned %d phrases\n", len(learned))
+	for i := 0; i < len(learned) && i < 10; i++ {
+		fmt.Println(learned[i].Phrase)
+	}
+	fmt.Print("\n")
+
+	return table, nil
 }
 
-func trainModel() error {
-	fmt.Println("Training Model ...")
+func trainModel(ctx context.Context, table *phrases.Table, skipGram bool, output string) (*word2vec.Model, error) {
+	fmt.Printf("Training Model %s ...\n", output)
 	fmt.Print("\n")
 
+	// The corpus is rewritten with the words of a phrase joined by "_",
+	// which the phrase tokenizer doesn't split on.
+	sentences := word2vec.Sentences(table.Sentences(cleanData))
+
+	input := word2vec.SentenceReader(ctx, sentences)
+	defer input.Close()
+
 	config := word2vec.Config{
 		Corpus: word2vec.ConfigCorpus{
-			InputFile: "zarf/data/example3.words",
-			Tokenizer: " \n,.-!?:;/\"#$%&'()*+<=>@[]\\^_`{|}~\t\v\f\r",
+			Input:     input,
+			Tokenizer: table.Tokenizer(),
 			Sequencer: ".\n?!",
 		},
 		Vector: word2vec.ConfigWordVector{
@@ -126,44 +202,61 @@ func trainModel() error {
 			Epoch: 10,
 			Rate:  0.05,
 		},
-		UseSkipGram:            false,
-		UseCBOW:                true,
+		Subwords: word2vec.ConfigSubwords{
+			MinN:    3,
+			MaxN:    6,
+			Buckets: 200000,
+		},
+		UseSkipGram:            skipGram,
+		UseCBOW:                !skipGram,
 		UseNegativeSampling:    true,
 		UseHierarchicalSoftMax: false,
 		SizeNegativeSampling:   5,
 		Threads:                runtime.GOMAXPROCS(0),
 		Verbose:                true,
-		Output:                 "zarf/data/example3.model",
+		Output:                 output,
 	}
 
-	if err := word2vec.Train(config); err != nil {
-		return fmt.Errorf("train: %w", err)
+	model, err := word2vec.Train(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("train: %w", err)
 	}
 
+	fmt.Printf("Vocabulary: %d words, %d dimensions\n", model.VocabSize(), model.Dim())
+
 	fmt.Print("\n")
 
-	return nil
+	return model, nil
 }
 
-func testModel() error {
+func testModel(table *phrases.Table) error {
 	fmt.Println("Testing Model ...")
 	fmt.Print("\n")
 
-	w2v, err := word2vec.Load("zarf/data/example3.model", 300)
+	w2v, err := purego.Load("zarf/data/example3.model", 300)
 	if err != nil {
 		return err
 	}
 
-	seq := make([]word2vec.Nearest, 10)
+	w2v.SetTokenizer(table.Tokenizer())
+
+	seq := make([]purego.Nearest, 10)
 	w2v.Lookup("bad", seq)
 
 	fmt.Println("Top 10 words similar to \"bad\"")
 	fmt.Println(seq)
 	fmt.Print("\n")
 
+	w2v.Lookup(table.Rewrite("battery life"), seq)
+
+	fmt.Println("Top 10 words similar to \"battery life\"")
+	fmt.Println(seq)
+	fmt.Print("\n")
+
 	// -------------------------------------------------------------------------
 
-	words := []string{"terrible", "horrible", "price", "battery", "great", "nice"}
+	// The subword vectors give misspelled words like "batery" a vector.
+	words := []string{"terrible", "horrible", "price", "battery", "great", "nice", "battery", "batery"}
 
 	for i := 0; i < len(words); i = i + 2 {
 		var word1 [300]float32
@@ -181,5 +274,156 @@ func testModel() error {
 		fmt.Printf("The cosine similarity between the word %q and %q: %.3f%%\n", words[i], words[i+1], v*100)
 	}
 
+	fmt.Print("\n")
+
+	return nil
+}
+
+func evaluateModels() error {
+	models := []struct {
+		name string
+		file string
+	}{
+		{"CBOW", "zarf/data/example3.model"},
+		{"Skip-Gram", "zarf/data/example3-sg.model"},
+	}
+
+	for _, m := range models {
+		fmt.Printf("Evaluating Model %s ...\n", m.name)
+		fmt.Print("\n")
+
+		w2v, err := purego.Load(m.file, 300)
+		if err != nil {
+			return err
+		}
+
+		if err := evaluateModel(&w2v); err != nil {
+			return fmt.Errorf("%s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func evaluateModel(model eval.Model) error {
+	config := eval.NewConfigDefault()
+
+	pairs, err := eval.LoadPairs("zarf/data/wordsim.tsv")
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		fmt.Println("Skipping word similarity, zarf/data/wordsim.tsv not found")
+
+	case err != nil:
+		return fmt.Errorf("load pairs: %w", err)
+
+	default:
+		sim, err := eval.Similarity(model, pairs, config)
+		if err != nil {
+			return fmt.Errorf("similarity: %w", err)
+		}
+
+		fmt.Printf("Word similarity: spearman %.3f, coverage %.1f%% of %d pairs\n", sim.Spearman, sim.Coverage()*100, sim.Pairs)
+	}
+
+	questions, err := eval.LoadQuestions("zarf/data/questions-words.txt")
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		fmt.Println("Skipping analogies, zarf/data/questions-words.txt not found")
+
+	case err != nil:
+		return fmt.Errorf("load questions: %w", err)
+
+	default:
+		analogy, err := eval.Analogy(model, questions, config)
+		if err != nil {
+			return fmt.Errorf("analogy: %w", err)
+		}
+
+		for _, s := range append(analogy.Sections, analogy.Total) {
+			fmt.Printf("Analogy %s: accuracy %.1f%%, coverage %.1f%% of %d questions\n", s.Section, s.Accuracy()*100, s.Coverage()*100, s.Questions)
+		}
+	}
+
+	fmt.Print("\n")
+
+	return nil
+}
+
+func searchReviews(model *word2vec.Model, table *phrases.Table) error {
+	fmt.Println("Searching Reviews ...")
+	fmt.Print("\n")
+
+	type document struct {
+		ReviewText string
+	}
+
+	input, err := os.Open("zarf/data/example3.json")
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer input.Close()
+
+	docs, err := word2vec.NewDocModel(model.Dim())
+	if err != nil {
+		return fmt.Errorf("new doc model: %w", err)
+	}
+	defer docs.Close()
+
+	var reviews []string
+	embedding := make([]float32, model.Dim())
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		var d document
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			return fmt.Errorf("unmarshal: %w", err)
+		}
+
+		id := uint64(len(reviews))
+		reviews = append(reviews, d.ReviewText)
+
+		// Reviews without a word the model knows or can compose from its
+		// subwords have no embedding.
+		if err := model.Embedding(table.Rewrite(stopwords.Remove(d.ReviewText)), embedding); err != nil {
+			continue
+		}
+
+		if err := docs.Set(id, embedding); err != nil {
+			return fmt.Errorf("set: %w", err)
+		}
+	}
+
+	// The document model can be reloaded with word2vec.LoadDocModel.
+	if err := docs.Save("zarf/data/example3.docs"); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	fmt.Printf("Stored %d review vectors\n", docs.Size())
+	fmt.Print("\n")
+
+	query := "battery does not hold a charge"
+	if err := model.Embedding(table.Rewrite(stopwords.Remove(query)), embedding); err != nil {
+		return fmt.Errorf("embedding: %w", err)
+	}
+
+	seq := make([]word2vec.DocNearest, 5)
+	if err := docs.Lookup(embedding, seq); err != nil {
+		return fmt.Errorf("lookup: %w", err)
+	}
+
+	fmt.Printf("Top 5 reviews similar to %q\n", query)
+	for _, n := range seq {
+		if n.Distance == 0 {
+			continue
+		}
+
+		review := reviews[n.ID]
+		if len(review) > 120 {
+			review = review[:120] + "..."
+		}
+
+		fmt.Printf("%.3f: %s\n", n.Distance, review)
+	}
+
 	return nil
 }
@@ -56,7 +56,16 @@ func run() error {
 	// -------------------------------------------------------------------------
 	// Connect to mongo
 
-	client, err := mongodb.Connect(ctx, "mongodb://localhost:27017", "ardan", "ardan")
+	// Load the mongodb settings. The defaults point to the local environment
+	// and can be overridden with MONGO_* environment variables or a config
+	// file named by MONGO_CONFIG_FILE.
+	cfg, err := mongodb.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
+	}
+
+	// Connect to mongodb.
+	client, err := mongodb.ConnectWithConfig(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("connectToMongo: %w", err)
 	}
@@ -13,6 +13,12 @@
 // run that program using `make clean-data`. This is here if you want to play
 // with your own chunking. How you chunk the data is critical to accuracy.
 //
+// The cleaner also writes the book sections in full to `zarf/data/book.sections`
+// and small child chunks of whole sentences to `zarf/data/book.children`. The
+// child chunks are vectorized into their own collection and reference the
+// section they came from, so a search can match a child chunk and hand the
+// model the whole section or the neighboring chunks.
+//
 // # Running the example:
 //
 //   $ make example6
@@ -41,9 +47,19 @@ import (
 )
 
 type document struct {
-	ID        int       `bson:"id"`
-	Text      string    `bson:"text"`
-	Embedding []float32 `bson:"embedding"`
+	ID        int                    `bson:"id"`
+	Text      string                 `bson:"text"`
+	Embedding []float32              `bson:"embedding"`
+	Model     mongodb.EmbeddingModel `bson:"embedding_model"`
+}
+
+// embeddingModel describes the model used to produce the embeddings. Every
+// document is tagged with this so a future model change can't silently mix
+// vector spaces.
+var embeddingModel = mongodb.EmbeddingModel{
+	Name:       "mxbai-embed-large",
+	Dimensions: 1024,
+	Version:    1,
 }
 
 func main() {
@@ -53,7 +69,7 @@ func main() {
 }
 
 func run() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
 	if err := createEmbeddings(); err != nil {
@@ -69,6 +85,14 @@ func run() error {
 		return fmt.Errorf("insertEmbeddings: %w", err)
 	}
 
+	if err := createChildEmbeddings(); err != nil {
+		return fmt.Errorf("createChildEmbeddings: %w", err)
+	}
+
+	if err := insertSections(ctx, col.Database()); err != nil {
+		return fmt.Errorf("insertSections: %w", err)
+	}
+
 	return nil
 }
 
@@ -80,7 +104,7 @@ func createEmbeddings() error {
 	}
 
 	// Open a connection with ollama to access the model.
-	llm, err := ollama.New(ollama.WithModel("mxbai-embed-large"))
+	llm, err := ollama.New(ollama.WithModel(embeddingModel.Name))
 	if err != nil {
 		return fmt.Errorf("ollama: %w", err)
 	}
@@ -126,6 +150,7 @@ func createEmbeddings() error {
 			ID:        counter,
 			Text:      chunk,
 			Embedding: embedding[0],
+			Model:     embeddingModel,
 		}
 
 		// Convert to json.
@@ -150,10 +175,79 @@ func createEmbeddings() error {
 	return nil
 }
 
+func createChildEmbeddings() error {
+
+	// If the embeddings already exist, we don't need to do this again.
+	if _, err := os.Stat("zarf/data/book.children.embeddings"); err == nil {
+		return nil
+	}
+
+	// Open a connection with ollama to access the model.
+	llm, err := ollama.New(ollama.WithModel(embeddingModel.Name))
+	if err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	// Open the book file with the child chunks.
+	input, err := os.Open("zarf/data/book.children")
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer input.Close()
+
+	// Create the embeddings.
+	output, err := os.Create("zarf/data/book.children.embeddings")
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer output.Close()
+
+	enc := json.NewEncoder(output)
+
+	fmt.Print("\n")
+	fmt.Print("\033[s")
+
+	// Read one child chunk at a time (each line) and get the vector embedding.
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		var chunk mongodb.Chunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return fmt.Errorf("unmarshal: %w", err)
+		}
+
+		fmt.Print("\033[u\033[K")
+		fmt.Printf("Vectorizing Child Chunk: %d", chunk.ID)
+
+		embedding, err := llm.CreateEmbedding(context.Background(), []string{chunk.Text})
+		if err != nil {
+			return fmt.Errorf("create embedding: %w", err)
+		}
+
+		chunk.Embedding = embedding[0]
+		chunk.Model = &embeddingModel
+
+		if err := enc.Encode(chunk); err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+	}
+
+	fmt.Print("\n")
+
+	return nil
+}
+
 func setupDatabase(ctx context.Context) (*mongo.Collection, error) {
 
+	// Load the mongodb settings. The defaults point to the local environment
+	// and can be overridden with MONGO_* environment variables or a config
+	// file named by MONGO_CONFIG_FILE.
+	cfg, err := mongodb.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loadConfig: %w", err)
+	}
+
 	// Connect to mongodb.
-	client, err := mongodb.Connect(ctx, "mongodb://localhost:27017", "ardan", "ardan")
+	client, err := mongodb.ConnectWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("connectToMongo: %w", err)
 	}
@@ -163,38 +257,57 @@ func setupDatabase(ctx context.Context) (*mongo.Collection, error) {
 
 	db := client.Database(dbName)
 
-	// Create database and collection.
-	col, err := mongodb.CreateCollection(ctx, db, collectionName)
+	// Construct the registry of corpora. The book is one corpus, other books
+	// and docs can be provisioned next to it with their own collection and
+	// vector index.
+	corpora, err := mongodb.NewCorpora(mongodb.CorporaConfig{
+		Client:   client,
+		Registry: db.Collection("corpora"),
+		EmbedderFor: func(model mongodb.EmbeddingModel) (mongodb.Embedder, error) {
+			return ollama.New(ollama.WithModel(model.Name))
+		},
+		Embeddings: "embeddings",
+	})
 	if err != nil {
-		return nil, fmt.Errorf("createCollection: %w", err)
+		return nil, fmt.Errorf("newCorpora: %w", err)
 	}
 
-	fmt.Println("Created Collection")
-
-	const indexName = "vector_index"
-	settings := mongodb.VectorIndexSettings{
-		NumDimensions: 1024,
-		Path:          "embedding",
-		Similarity:    "cosine",
+	corpus := mongodb.Corpus{
+		Name:        collectionName,
+		Database:    dbName,
+		Collection:  collectionName,
+		VectorIndex: "vector_index",
+		Path:        "embedding",
+		Similarity:  "cosine",
+		Model:       embeddingModel,
+		TextKey:     "text",
+		UniqueKey:   "id",
 	}
 
-	// Create vector index.
-	if err := mongodb.CreateVectorIndex(ctx, col, indexName, settings); err != nil {
-		return nil, fmt.Errorf("createVectorIndex: %w", err)
+	// Create the collection, vector index and unique index for the corpus.
+	// The vector index becomes the active embedding for readers unless a
+	// migration already switched them to another model.
+	col, err := corpora.Provision(ctx, corpus)
+	if err != nil {
+		return nil, fmt.Errorf("provision: %w", err)
 	}
 
-	fmt.Println("Created Vector Index")
+	fmt.Println("Provisioned Corpus")
 
-	unique := true
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "id", Value: 1}},
-		Options: &options.IndexOptions{Unique: &unique},
+	const textIndexName = "text_index"
+	textSettings := mongodb.SearchIndexSettings{
+		Analyzer: "lucene.english",
+		Fields: []mongodb.SearchField{
+			{Path: "text", Type: "string"},
+		},
 	}
 
-	// Create a unique index for the document.
-	col.Indexes().CreateOne(ctx, indexModel)
+	// Create full-text search index for keyword retrieval.
+	if err := mongodb.CreateSearchIndex(ctx, col, textIndexName, textSettings); err != nil {
+		return nil, fmt.Errorf("createSearchIndex: %w", err)
+	}
 
-	fmt.Println("Created Unique Index")
+	fmt.Println("Created Text Search Index")
 
 	return col, nil
 }
@@ -230,6 +343,12 @@ func insertEmbeddings(ctx context.Context, col *mongo.Collection) error {
 			return fmt.Errorf("unmarshal: %w", err)
 		}
 
+		// Embeddings files written before model tagging existed were all
+		// produced by the current model.
+		if d.Model.Name == "" {
+			d.Model = embeddingModel
+		}
+
 		// Check if this document is already in the database.
 		res := col.FindOne(ctx, bson.D{{Key: "id", Value: d.ID}})
 		if res.Err() == nil {
@@ -251,3 +370,118 @@ func insertEmbeddings(ctx context.Context, col *mongo.Collection) error {
 
 	return nil
 }
+
+func insertSections(ctx context.Context, db *mongo.Database) error {
+
+	// Create the sections collection with a unique index on the section id
+	// so the parent sections can be fetched for the child chunks.
+	sectionsCol, err := mongodb.CreateCollection(ctx, db, "book_sections")
+	if err != nil {
+		return fmt.Errorf("createCollection: %w", err)
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	if _, err := sectionsCol.Indexes().CreateOne(ctx, indexModel); err != nil {
+		return fmt.Errorf("create unique index: %w", err)
+	}
+
+	// Create the child chunks collection with a vector index for searching
+	// and an index for fetching the neighbors of a chunk.
+	childrenCol, err := mongodb.CreateCollection(ctx, db, "book_children")
+	if err != nil {
+		return fmt.Errorf("createCollection: %w", err)
+	}
+
+	settings := mongodb.VectorIndexSettings{
+		NumDimensions: embeddingModel.Dimensions,
+		Path:          "embedding",
+		Similarity:    "cosine",
+	}
+
+	if err := mongodb.CreateVectorIndex(ctx, childrenCol, "vector_index", settings); err != nil {
+		return fmt.Errorf("createVectorIndex: %w", err)
+	}
+
+	indexModel = mongo.IndexModel{
+		Keys: bson.D{{Key: "section_id", Value: 1}, {Key: "seq", Value: 1}},
+	}
+
+	if _, err := childrenCol.Indexes().CreateOne(ctx, indexModel); err != nil {
+		return fmt.Errorf("create section index: %w", err)
+	}
+
+	fmt.Println("Created Sections And Child Chunks")
+
+	// Upsert the sections and the child chunks by id.
+	if err := upsertFile(ctx, sectionsCol, "zarf/data/book.sections", func(data []byte) (int, any, error) {
+		var section mongodb.Section
+		err := json.Unmarshal(data, &section)
+		return section.ID, section, err
+	}); err != nil {
+		return fmt.Errorf("upsert sections: %w", err)
+	}
+
+	if err := upsertFile(ctx, childrenCol, "zarf/data/book.children.embeddings", func(data []byte) (int, any, error) {
+		var chunk mongodb.Chunk
+		err := json.Unmarshal(data, &chunk)
+
+		// Embeddings files written before model tagging existed were all
+		// produced by the current model.
+		if chunk.Model == nil {
+			chunk.Model = &embeddingModel
+		}
+
+		return chunk.ID, chunk, err
+	}); err != nil {
+		return fmt.Errorf("upsert children: %w", err)
+	}
+
+	return nil
+}
+
+// upsertFile replaces every document in the collection with the documents
+// decoded from the lines of the file, matched by id.
+func upsertFile(ctx context.Context, col *mongo.Collection, file string, decode func(data []byte) (int, any, error)) error {
+	input, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer input.Close()
+
+	var models []mongo.WriteModel
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		id, doc, err := decode(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("unmarshal: %w", err)
+		}
+
+		model := mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "id", Value: id}}).
+			SetReplacement(doc).
+			SetUpsert(true)
+
+		models = append(models, model)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	if _, err := col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("bulk write: %w", err)
+	}
+
+	return nil
+}
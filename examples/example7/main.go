@@ -3,6 +3,25 @@
 // the database. Then these chunks are sent to the Llama model to create a
 // coherent response.
 //
+// The conversation is stored in MongoDB under a session id so follow up
+// questions have the context of the previous ones, even across restarts.
+// Set the SESSION_ID environment variable to start or continue a specific
+// conversation.
+//
+// Answers are cached in MongoDB. When a question is similar enough to one
+// that was already answered, the cached answer is returned without calling
+// the Llama model. Every retrieval mode has its own cache since the answers
+// come from different sources.
+//
+// Set the RETRIEVAL environment variable to "section" to search the small
+// child chunks and answer from the whole book sections they belong to, or to
+// "window" to answer from the matched child chunks and their neighbors. Set it
+// to "graph" to expand the matched chunks through the knowledge graph built by
+// `make graph`, which helps with questions that span chapters.
+//
+// Set the METRICS_ADDR environment variable (ex. localhost:9090) to expose
+// the MongoDB command and pool metrics for Prometheus at /metrics.
+//
 // # Running the example:
 //
 //	$ make example7
@@ -19,6 +38,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
@@ -27,19 +47,10 @@ import (
 	"github.com/ardanlabs/ai-training/foundation/mongodb"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/ollama"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/tmc/langchaingo/schema"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type searchResult struct {
-	ID        int       `bson:"id"`
-	Text      string    `bson:"text"`
-	Embedding []float64 `bson:"embedding"`
-	Score     float64   `bson:"score"`
-}
-
-// =============================================================================
-
 func main() {
 	if err := run(); err != nil {
 		log.Fatal(err)
@@ -47,111 +58,351 @@ func main() {
 }
 
 func run() error {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Ask Bill a question about Go: ")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
 
-	question, _ := reader.ReadString('\n')
-	if question == "" {
-		return nil
+	// -------------------------------------------------------------------------
+	// Establish a connection with mongo and access the database.
+
+	// Load the mongodb settings. The defaults point to the local environment
+	// and can be overridden with MONGO_* environment variables or a config
+	// file named by MONGO_CONFIG_FILE.
+	cfg, err := mongodb.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
-	defer cancel()
+	// Collect metrics on every command and pool event so slow or empty
+	// vector searches can be diagnosed.
+	metrics := mongodb.NewCollector()
 
-	results, err := vectorSearch(ctx, question)
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+
+		go func() {
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Printf("metrics: %s", err)
+			}
+		}()
+	}
+
+	// Connect to mongodb.
+	client, err := mongodb.ConnectWithConfig(ctx, cfg, mongodb.MonitorOptions(metrics))
 	if err != nil {
-		return fmt.Errorf("vectorSearch: %w", err)
+		return fmt.Errorf("connectToMongo: %w", err)
 	}
+	defer client.Disconnect(context.Background())
 
-	if err := questionResponse(ctx, question, results); err != nil {
-		return fmt.Errorf("questionResponse: %w", err)
+	const dbName = "example5"
+
+	db := client.Database(dbName)
+
+	// -------------------------------------------------------------------------
+	// Load the conversation history for this session.
+
+	sessionID := os.Getenv("SESSION_ID")
+	if sessionID == "" {
+		sessionID = "default"
 	}
 
-	return nil
-}
+	historyCol := db.Collection("history")
+	if err := mongodb.CreateChatHistoryIndex(ctx, historyCol); err != nil {
+		return fmt.Errorf("createChatHistoryIndex: %w", err)
+	}
 
-func vectorSearch(ctx context.Context, question string) ([]searchResult, error) {
+	history, err := mongodb.NewChatHistory(mongodb.ChatHistoryConfig{
+		Collection: historyCol,
+		SessionID:  sessionID,
+		TTL:        24 * time.Hour,
+		Window:     10,
+	})
+	if err != nil {
+		return fmt.Errorf("newChatHistory: %w", err)
+	}
 
 	// -------------------------------------------------------------------------
-	// Use ollama to generate a vector embedding for the question.
+	// Choose how the book is searched.
 
-	// Open a connection with ollama to access the model.
-	llm, err := ollama.New(ollama.WithModel("mxbai-embed-large"))
+	retrieval := os.Getenv("RETRIEVAL")
+
+	cacheName := "cache"
+	if retrieval != "" {
+		cacheName = "cache_" + retrieval
+	}
+
+	cacheCfg := mongodb.AnswerCacheConfig{
+		Sources:   db.Collection("book"),
+		IndexName: "cache_index",
+		Threshold: .95,
+		TTL:       7 * 24 * time.Hour,
+		TextKey:   "text",
+	}
+
+	var parent *mongodb.ParentRetriever
+
+	switch retrieval {
+	case "", "graph":
+	case "section", "window":
+		parent, err = newParentRetriever(db, retrieval)
+		if err != nil {
+			return fmt.Errorf("newParentRetriever: %w", err)
+		}
+
+		// Sections and windows are not documents of the book collection, so
+		// the retriever that builds them reports their current text.
+		cacheCfg.Sources = nil
+		cacheCfg.SourceText = parent.SourceText
+
+	default:
+		return fmt.Errorf("unknown retrieval %q", retrieval)
+	}
+
+	// -------------------------------------------------------------------------
+	// Construct the semantic cache of previous answers.
+
+	// Open a connection with ollama to access the model used to compare
+	// questions.
+	cacheLLM, err := ollama.New(ollama.WithModel("mxbai-embed-large"))
 	if err != nil {
-		return nil, fmt.Errorf("ollama: %w", err)
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	cacheCfg.Collection = db.Collection(cacheName)
+	cacheCfg.Embedder = cacheLLM
+
+	if err := mongodb.CreateAnswerCacheIndexes(ctx, cacheCfg.Collection, cacheCfg.IndexName, 1024); err != nil {
+		return fmt.Errorf("createAnswerCacheIndexes: %w", err)
 	}
 
-	// Get the vector embedding for the question.
-	embedding, err := llm.CreateEmbedding(context.Background(), []string{question})
+	cache, err := mongodb.NewAnswerCache(cacheCfg)
 	if err != nil {
-		return nil, fmt.Errorf("create embedding: %w", err)
+		return fmt.Errorf("newAnswerCache: %w", err)
 	}
 
+	defer func() {
+		stats := cache.Stats()
+		fmt.Printf("\nCache: hits[%d] misses[%d] invalidations[%d]\n", stats.Hits, stats.Misses, stats.Invalidations)
+	}()
+
 	// -------------------------------------------------------------------------
-	// Establish a connection with mongo and access the collection.
+	// Answer questions until the user enters an empty line.
 
-	// Connect to mongodb.
-	client, err := mongodb.Connect(ctx, "mongodb://localhost:27017", "ardan", "ardan")
-	if err != nil {
-		return nil, fmt.Errorf("connectToMongo: %w", err)
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		fmt.Print("\nAsk Bill a question about Go: ")
+
+		question, _ := reader.ReadString('\n')
+		question = strings.TrimSpace(question)
+		if question == "" {
+			return nil
+		}
+
+		cached, hit, err := cache.Lookup(ctx, question)
+		if err != nil {
+			return fmt.Errorf("lookup: %w", err)
+		}
+
+		if hit {
+			fmt.Println(cached.Answer)
+
+			if err := remember(ctx, history, question, cached.Answer); err != nil {
+				return fmt.Errorf("remember: %w", err)
+			}
+
+			continue
+		}
+
+		results, err := vectorSearch(ctx, db, retrieval, parent, question)
+		if err != nil {
+			return fmt.Errorf("vectorSearch: %w", err)
+		}
+
+		answer, err := questionResponse(ctx, history, question, results)
+		if err != nil {
+			return fmt.Errorf("questionResponse: %w", err)
+		}
+
+		if answer == "" {
+			continue
+		}
+
+		if err := remember(ctx, history, question, answer); err != nil {
+			return fmt.Errorf("remember: %w", err)
+		}
+
+		// Answers can only be cached when every source is a stored document.
+		sources, ok := cacheSources(results)
+		if !ok {
+			continue
+		}
+
+		if err := cache.Store(ctx, question, answer, sources); err != nil {
+			return fmt.Errorf("store: %w", err)
+		}
+	}
+}
+
+func vectorSearch(ctx context.Context, db *mongo.Database, retrieval string, parent *mongodb.ParentRetriever, question string) ([]schema.Document, error) {
+	if parent != nil {
+		docs, err := parent.GetRelevantDocuments(ctx, question)
+		if err != nil {
+			return nil, fmt.Errorf("getRelevantDocuments: %w", err)
+		}
+
+		return docs, nil
 	}
 
-	const dbName = "example5"
 	const collectionName = "book"
 
 	// Capture a connection to the collection. We assume this exists with
 	// data already.
-	col := client.Database(dbName).Collection(collectionName)
+	col := db.Collection(collectionName)
 
 	// -------------------------------------------------------------------------
 	// Perform the vector search.
 
-	// We want to find the nearest neighbors from the question vector embedding.
-	pipeline := mongo.Pipeline{
-		{{
-			Key: "$vectorSearch",
-			Value: bson.M{
-				"index":         "vector_index",
-				"exact":         false,
-				"path":          "embedding",
-				"queryVector":   embedding[0],
-				"numCandidates": 2,
-				"limit":         2,
-			}},
+	// Use ollama to generate a vector embedding for the question. The model
+	// comes from the active embedding in the registry so the question is
+	// embedded by the same model that embedded the book. Until a model is
+	// registered, the book's original model and index are used.
+	embedderFor := func(model mongodb.EmbeddingModel) (mongodb.Embedder, error) {
+		return ollama.New(ollama.WithModel(model.Name))
+	}
+
+	llm, err := ollama.New(ollama.WithModel("mxbai-embed-large"))
+	if err != nil {
+		return nil, fmt.Errorf("ollama: %w", err)
+	}
+
+	// The retriever will generate a vector embedding for the question and
+	// find the nearest neighbors that score at or above 70%.
+	retriever, err := mongodb.NewRetriever(mongodb.RetrieverConfig{
+		Collection: col,
+		Embedder:   llm,
+		Search: mongodb.VectorSearchSettings{
+			IndexName:     "vector_index",
+			Path:          "embedding",
+			NumCandidates: 2,
+			Limit:         2,
 		},
-		{{
-			Key: "$project",
-			Value: bson.M{
-				"id":        1,
-				"text":      1,
-				"embedding": 1,
-				"score": bson.M{
-					"$meta": "vectorSearchScore",
-				},
-			}},
+		TextKey:        "text",
+		ScoreThreshold: .70,
+		Registry:       db.Collection("embeddings"),
+		EmbedderFor:    embedderFor,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("newRetriever: %w", err)
+	}
+
+	if retrieval == "graph" {
+		return graphSearch(ctx, db, retriever, question)
+	}
+
+	docs, err := retriever.GetRelevantDocuments(ctx, question)
+	if err != nil {
+		return nil, fmt.Errorf("getRelevantDocuments: %w", err)
+	}
+
+	return docs, nil
+}
+
+func newParentRetriever(db *mongo.Database, retrieval string) (*mongodb.ParentRetriever, error) {
+
+	// Use ollama to generate a vector embedding for the question.
+	llm, err := ollama.New(ollama.WithModel("mxbai-embed-large"))
+	if err != nil {
+		return nil, fmt.Errorf("ollama: %w", err)
+	}
+
+	mode := mongodb.ExpandSection
+	if retrieval == "window" {
+		mode = mongodb.ExpandWindow
+	}
+
+	// The retriever will search the small child chunks for the question and
+	// expand the chunks that score at or above 70% into their sections or
+	// windows, keeping the total context under 2000 words.
+	retriever, err := mongodb.NewParentRetriever(mongodb.ParentRetrieverConfig{
+		Chunks:   db.Collection("book_children"),
+		Sections: db.Collection("book_sections"),
+		Embedder: llm,
+		Search: mongodb.VectorSearchSettings{
+			IndexName:     "vector_index",
+			Path:          "embedding",
+			NumCandidates: 25,
+			Limit:         5,
 		},
+		Mode:           mode,
+		Window:         2,
+		TokenBudget:    2000,
+		ScoreThreshold: .70,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("newParentRetriever: %w", err)
+	}
+
+	return retriever, nil
+}
+
+func graphSearch(ctx context.Context, db *mongo.Database, base schema.Retriever, question string) ([]schema.Document, error) {
+	graph, err := mongodb.NewGraphStore(db.Collection("entities"), db.Collection("relations"), db.Collection("extractions"))
+	if err != nil {
+		return nil, fmt.Errorf("newGraphStore: %w", err)
 	}
 
-	cur, err := col.Aggregate(ctx, pipeline)
+	// The retriever will expand the chunks found by the vector search to the
+	// concepts within two relations of them, and add up to 3 chunks that are
+	// most connected to those concepts.
+	retriever, err := mongodb.NewGraphRetriever(mongodb.GraphRetrieverConfig{
+		Base:      base,
+		Graph:     graph,
+		Chunks:    db.Collection("book"),
+		ChunkKey:  "id",
+		TextKey:   "text",
+		Depth:     2,
+		MaxChunks: 3,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("aggregate: %w", err)
+		return nil, fmt.Errorf("newGraphRetriever: %w", err)
 	}
-	defer cur.Close(ctx)
 
-	var results []searchResult
-	if err := cur.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("all: %w", err)
+	docs, err := retriever.GetRelevantDocuments(ctx, question)
+	if err != nil {
+		return nil, fmt.Errorf("getRelevantDocuments: %w", err)
+	}
+
+	return docs, nil
+}
+
+// cacheSources returns the documents that carry the _id of the stored
+// document, section or window they came from. The relations summary added by
+// graph retrieval is left out since it's built from the chunks it returns.
+// The boolean is false when any other document has no _id.
+func cacheSources(docs []schema.Document) ([]schema.Document, bool) {
+	sources := make([]schema.Document, 0, len(docs))
+
+	for _, doc := range docs {
+		if _, exists := doc.Metadata["_id"]; exists {
+			sources = append(sources, doc)
+			continue
+		}
+
+		if graph, _ := doc.Metadata["graph"].(bool); !graph {
+			return nil, false
+		}
 	}
 
-	return results, nil
+	return sources, true
 }
 
-func questionResponse(ctx context.Context, question string, results []searchResult) error {
+func questionResponse(ctx context.Context, history schema.ChatMessageHistory, question string, results []schema.Document) (string, error) {
 
 	// Open a connection with ollama to access the model.
 	llm, err := ollama.New(ollama.WithModel("llama3"))
 	if err != nil {
-		return fmt.Errorf("ollama: %w", err)
+		return "", fmt.Errorf("ollama: %w", err)
 	}
 
 	// Format a prompt to direct the model what to do with the content and
@@ -160,6 +411,8 @@ func questionResponse(ctx context.Context, question string, results []searchResu
 	If you don't know the answer, say that you don't know.
 	
 	Context: %s
+
+	Previous conversation: %s
 	
 	Question: %s
 
@@ -170,19 +423,28 @@ func questionResponse(ctx context.Context, question string, results []searchResu
 
 	var chunks strings.Builder
 	for _, res := range results {
-		if res.Score >= .70 {
-			chunks.WriteString(res.Text)
-			chunks.WriteString(".\n")
-		}
+		chunks.WriteString(res.PageContent)
+		chunks.WriteString(".\n")
 	}
 
 	content := chunks.String()
 	if content == "" {
 		fmt.Println("Don't have enough information to provide an answer")
-		return nil
+		return "", nil
 	}
 
-	finalPrompt := fmt.Sprintf(prompt, content, question)
+	// Pull the previous questions and answers for this session.
+	messages, err := history.Messages(ctx)
+	if err != nil {
+		return "", fmt.Errorf("messages: %w", err)
+	}
+
+	conversation, err := llms.GetBufferString(messages, "Question", "Answer")
+	if err != nil {
+		return "", fmt.Errorf("getBufferString: %w", err)
+	}
+
+	finalPrompt := fmt.Sprintf(prompt, content, conversation, question)
 
 	// Setup a wait group to wait for the entire response.
 	var wg sync.WaitGroup
@@ -200,12 +462,26 @@ func questionResponse(ctx context.Context, question string, results []searchResu
 	}
 
 	// Send the prompt to the model server.
-	if _, err := llm.Call(ctx, finalPrompt, llms.WithStreamingFunc(f)); err != nil {
-		return fmt.Errorf("call: %w", err)
+	answer, err := llm.Call(ctx, finalPrompt, llms.WithStreamingFunc(f))
+	if err != nil {
+		return "", fmt.Errorf("call: %w", err)
 	}
 
 	// Wait until we receive the entire response.
 	wg.Wait()
 
+	return answer, nil
+}
+
+// remember stores the question and answer for the rest of the conversation.
+func remember(ctx context.Context, history schema.ChatMessageHistory, question string, answer string) error {
+	if err := history.AddUserMessage(ctx, question); err != nil {
+		return fmt.Errorf("addUserMessage: %w", err)
+	}
+
+	if err := history.AddAIMessage(ctx, answer); err != nil {
+		return fmt.Errorf("addAIMessage: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,382 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tmc/langchaingo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AnswerCacheConfig represents the settings required to construct a semantic
+// answer cache.
+type AnswerCacheConfig struct {
+	// Collection represents the collection holding the cached answers.
+	Collection *mongo.Collection
+
+	// Sources represents the collection holding the chunks the answers were
+	// produced from. Cached answers whose chunks have changed are invalidated.
+	Sources *mongo.Collection
+
+	// SourceText returns the current text of the sources with the specified
+	// ids. It's required when the sources are not documents in a single
+	// collection, such as the windows returned by a ParentRetriever, and
+	// replaces the Sources collection.
+	SourceText func(ctx context.Context, ids []any) (map[any]string, error)
+
+	Embedder Embedder
+
+	// IndexName represents the vector index on the cached questions.
+	// Ex: cache_index
+	IndexName string
+
+	// Threshold represents the minimum similarity between the incoming and
+	// cached question for a hit.
+	// Ex: 0.95
+	Threshold float64
+
+	// TTL represents how long an answer is cached.
+	// Ex: 24h
+	TTL time.Duration
+
+	// TextKey represents the field in the sources collection that holds the
+	// chunk text.
+	// Ex: text
+	TextKey string
+}
+
+// CachedAnswer represents an answer found in the cache.
+type CachedAnswer struct {
+	Question string
+	Answer   string
+	Sources  []schema.Document
+	Score    float64
+}
+
+// CacheStats represents the counters collected by the answer cache.
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+}
+
+// AnswerCache provides a semantic cache of previously answered questions.
+type AnswerCache struct {
+	col        *mongo.Collection
+	sources    *mongo.Collection
+	sourceText func(ctx context.Context, ids []any) (map[any]string, error)
+	embedder   Embedder
+	indexName  string
+	threshold  float64
+	ttl        time.Duration
+	textKey    string
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+// NewAnswerCache constructs an answer cache for use.
+func NewAnswerCache(cfg AnswerCacheConfig) (*AnswerCache, error) {
+	if cfg.Collection == nil {
+		return nil, errors.New("collection is required")
+	}
+
+	if cfg.Sources == nil && cfg.SourceText == nil {
+		return nil, errors.New("sources collection or sourceText is required")
+	}
+
+	if cfg.Embedder == nil {
+		return nil, errors.New("embedder is required")
+	}
+
+	if cfg.IndexName == "" {
+		return nil, errors.New("index name is required")
+	}
+
+	if cfg.Threshold <= 0 || cfg.Threshold > 1 {
+		return nil, errors.New("threshold must be between 0 and 1")
+	}
+
+	if cfg.TTL <= 0 {
+		return nil, errors.New("ttl must be greater than zero")
+	}
+
+	textKey := cfg.TextKey
+	if textKey == "" {
+		textKey = "text"
+	}
+
+	c := AnswerCache{
+		col:        cfg.Collection,
+		sources:    cfg.Sources,
+		sourceText: cfg.SourceText,
+		embedder:   cfg.Embedder,
+		indexName:  cfg.IndexName,
+		threshold:  cfg.Threshold,
+		ttl:        cfg.TTL,
+		textKey:    textKey,
+	}
+
+	return &c, nil
+}
+
+// CreateAnswerCacheIndexes creates the vector index on the cached questions
+// and the TTL index that expires old answers.
+func CreateAnswerCacheIndexes(ctx context.Context, col *mongo.Collection, indexName string, numDimensions int) error {
+	settings := VectorIndexSettings{
+		NumDimensions: numDimensions,
+		Path:          "embedding",
+		Similarity:    "cosine",
+	}
+
+	if err := CreateVectorIndex(ctx, col, indexName, settings); err != nil {
+		return fmt.Errorf("createVectorIndex: %w", err)
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if _, err := col.Indexes().CreateOne(ctx, indexModel); err != nil {
+		return fmt.Errorf("create index: %w", err)
+	}
+
+	return nil
+}
+
+// Lookup searches the cache for a previously answered question that is
+// similar to the specified question. The boolean is false on a miss.
+func (c *AnswerCache) Lookup(ctx context.Context, question string) (CachedAnswer, bool, error) {
+	embedding, err := c.embed(ctx, question)
+	if err != nil {
+		return CachedAnswer{}, false, err
+	}
+
+	settings := VectorSearchSettings{
+		IndexName:     c.indexName,
+		Path:          "embedding",
+		NumCandidates: 10,
+		Limit:         1,
+	}
+
+	var entries []cacheEntry
+	if err := VectorSearch(ctx, c.col, settings, embedding, &entries); err != nil {
+		return CachedAnswer{}, false, fmt.Errorf("vectorSearch: %w", err)
+	}
+
+	// The TTL monitor only runs periodically, so expired answers can still
+	// be found and must be treated as a miss.
+	if len(entries) == 0 || entries[0].Score < c.threshold || time.Now().After(entries[0].Expires) {
+		c.misses.Add(1)
+		return CachedAnswer{}, false, nil
+	}
+
+	entry := entries[0]
+
+	current, err := c.sourcesCurrent(ctx, entry.Sources)
+	if err != nil {
+		return CachedAnswer{}, false, fmt.Errorf("sourcesCurrent: %w", err)
+	}
+
+	if !current {
+		if _, err := c.col.DeleteOne(ctx, bson.D{{Key: "_id", Value: entry.ID}}); err != nil {
+			return CachedAnswer{}, false, fmt.Errorf("delete: %w", err)
+		}
+
+		c.invalidations.Add(1)
+		c.misses.Add(1)
+		return CachedAnswer{}, false, nil
+	}
+
+	c.hits.Add(1)
+
+	answer := CachedAnswer{
+		Question: entry.Question,
+		Answer:   entry.Answer,
+		Sources:  make([]schema.Document, len(entry.Sources)),
+		Score:    entry.Score,
+	}
+
+	for i, src := range entry.Sources {
+		answer.Sources[i] = schema.Document{
+			PageContent: src.Text,
+			Metadata:    src.Metadata,
+			Score:       src.Score,
+		}
+	}
+
+	return answer, true, nil
+}
+
+// Store caches the answer to the question along with the source documents
+// used to produce it. The sources must carry their _id in the metadata, as
+// returned by the Retriever or for the expanded content of a ParentRetriever,
+// so the answer can be invalidated when they change.
+func (c *AnswerCache) Store(ctx context.Context, question string, answer string, sources []schema.Document) error {
+	embedding, err := c.embed(ctx, question)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	entry := cacheEntry{
+		Question:  question,
+		Answer:    answer,
+		Embedding: embedding,
+		Sources:   make([]cacheSource, len(sources)),
+		Created:   now,
+		Expires:   now.Add(c.ttl),
+	}
+
+	for i, src := range sources {
+		id, exists := src.Metadata["_id"]
+		if !exists {
+			return fmt.Errorf("source %d has no _id in its metadata", i)
+		}
+
+		entry.Sources[i] = cacheSource{
+			ID:       id,
+			Hash:     contentHash(src.PageContent),
+			Text:     src.PageContent,
+			Metadata: src.Metadata,
+			Score:    src.Score,
+		}
+	}
+
+	if _, err := c.col.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+
+	return nil
+}
+
+// Invalidate removes every cached answer produced from any of the specified
+// source ids. It returns the number of answers removed.
+func (c *AnswerCache) Invalidate(ctx context.Context, sourceIDs ...any) (int64, error) {
+	if len(sourceIDs) == 0 {
+		return 0, nil
+	}
+
+	filter := bson.D{{Key: "sources.id", Value: bson.D{{Key: "$in", Value: sourceIDs}}}}
+
+	res, err := c.col.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("delete: %w", err)
+	}
+
+	c.invalidations.Add(uint64(res.DeletedCount))
+
+	return res.DeletedCount, nil
+}
+
+// Stats returns the current cache counters.
+func (c *AnswerCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+// =============================================================================
+
+type cacheSource struct {
+	ID       any            `bson:"id"`
+	Hash     string         `bson:"hash"`
+	Text     string         `bson:"text"`
+	Metadata map[string]any `bson:"metadata"`
+	Score    float32        `bson:"score"`
+}
+
+type cacheEntry struct {
+	ID        any           `bson:"_id,omitempty"`
+	Question  string        `bson:"question"`
+	Answer    string        `bson:"answer"`
+	Embedding []float32     `bson:"embedding"`
+	Sources   []cacheSource `bson:"sources"`
+	Created   time.Time     `bson:"created"`
+	Expires   time.Time     `bson:"expires"`
+	Score     float64       `bson:"score,omitempty"`
+}
+
+func (c *AnswerCache) embed(ctx context.Context, question string) ([]float32, error) {
+	embedding, err := c.embedder.CreateEmbedding(ctx, []string{question})
+	if err != nil {
+		return nil, fmt.Errorf("create embedding: %w", err)
+	}
+
+	if len(embedding) == 0 {
+		return nil, errors.New("no embedding returned")
+	}
+
+	return embedding[0], nil
+}
+
+// sourcesCurrent reports whether every source chunk still exists with the
+// same text it had when the answer was cached.
+func (c *AnswerCache) sourcesCurrent(ctx context.Context, sources []cacheSource) (bool, error) {
+	if len(sources) == 0 {
+		return true, nil
+	}
+
+	ids := make([]any, len(sources))
+	for i, src := range sources {
+		ids[i] = src.ID
+	}
+
+	readText := c.readSources
+	if c.sourceText != nil {
+		readText = c.sourceText
+	}
+
+	texts, err := readText(ctx, ids)
+	if err != nil {
+		return false, fmt.Errorf("sourceText: %w", err)
+	}
+
+	for _, src := range sources {
+		text, exists := texts[src.ID]
+		if !exists || contentHash(text) != src.Hash {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// readSources returns the text of the documents in the sources collection.
+func (c *AnswerCache) readSources(ctx context.Context, ids []any) (map[any]string, error) {
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	projection := bson.D{{Key: c.textKey, Value: 1}}
+
+	cur, err := c.sources.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	texts := make(map[any]string, len(ids))
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("decode: %w", err)
+		}
+
+		text, _ := doc[c.textKey].(string)
+		texts[doc["_id"]] = text
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, fmt.Errorf("cursor: %w", err)
+	}
+
+	return texts, nil
+}
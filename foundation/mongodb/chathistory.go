@@ -0,0 +1,286 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChatHistoryConfig represents the settings required to construct a chat
+// history for a session.
+type ChatHistoryConfig struct {
+	Collection *mongo.Collection
+
+	// SessionID represents the conversation the history belongs to.
+	SessionID string
+
+	// TTL represents how long a session is kept after its last write. Zero
+	// keeps the session forever.
+	// Ex: 24h
+	TTL time.Duration
+
+	// Window represents the maximum number of messages kept for a session.
+	// Older messages are dropped as new ones are added. Zero keeps every
+	// message.
+	// Ex: 20
+	Window int
+}
+
+// ChatHistory implements the langchaingo schema.ChatMessageHistory interface
+// with a single MongoDB document per session.
+type ChatHistory struct {
+	col       *mongo.Collection
+	sessionID string
+	ttl       time.Duration
+	window    int
+}
+
+var _ schema.ChatMessageHistory = (*ChatHistory)(nil)
+
+// NewChatHistory constructs a chat history for the specified session.
+func NewChatHistory(cfg ChatHistoryConfig) (*ChatHistory, error) {
+	if cfg.Collection == nil {
+		return nil, errors.New("collection is required")
+	}
+
+	if cfg.SessionID == "" {
+		return nil, errors.New("session id is required")
+	}
+
+	if cfg.Window < 0 {
+		return nil, errors.New("window can't be negative")
+	}
+
+	h := ChatHistory{
+		col:       cfg.Collection,
+		sessionID: cfg.SessionID,
+		ttl:       cfg.TTL,
+		window:    cfg.Window,
+	}
+
+	return &h, nil
+}
+
+// CreateChatHistoryIndex creates the TTL index that expires sessions that
+// haven't been written to within their TTL.
+func CreateChatHistoryIndex(ctx context.Context, col *mongo.Collection) error {
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if _, err := col.Indexes().CreateOne(ctx, indexModel); err != nil {
+		return fmt.Errorf("create index: %w", err)
+	}
+
+	return nil
+}
+
+// AddMessage adds a message to the session.
+func (h *ChatHistory) AddMessage(ctx context.Context, message llms.ChatMessage) error {
+	msg, err := toChatMessageDoc(message)
+	if err != nil {
+		return err
+	}
+
+	each := bson.D{{Key: "$each", Value: []chatMessageDoc{msg}}}
+	if h.window > 0 {
+		each = append(each, bson.E{Key: "$slice", Value: -h.window})
+	}
+
+	return h.write(ctx, nil, bson.D{{Key: "messages", Value: each}})
+}
+
+// AddUserMessage adds a human message to the session.
+func (h *ChatHistory) AddUserMessage(ctx context.Context, message string) error {
+	return h.AddMessage(ctx, llms.HumanChatMessage{Content: message})
+}
+
+// AddAIMessage adds an AI message to the session.
+func (h *ChatHistory) AddAIMessage(ctx context.Context, message string) error {
+	return h.AddMessage(ctx, llms.AIChatMessage{Content: message})
+}
+
+// Clear removes the session and all of its messages and metadata.
+func (h *ChatHistory) Clear(ctx context.Context) error {
+	if _, err := h.col.DeleteOne(ctx, bson.D{{Key: "_id", Value: h.sessionID}}); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	return nil
+}
+
+// Messages returns the messages for the session, oldest first.
+func (h *ChatHistory) Messages(ctx context.Context) ([]llms.ChatMessage, error) {
+	session, err := h.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]llms.ChatMessage, 0, len(session.Messages))
+	for _, msg := range session.Messages {
+		m, err := msg.toChatMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+// SetMessages replaces the messages for the session.
+func (h *ChatHistory) SetMessages(ctx context.Context, messages []llms.ChatMessage) error {
+	if h.window > 0 && len(messages) > h.window {
+		messages = messages[len(messages)-h.window:]
+	}
+
+	docs := make([]chatMessageDoc, 0, len(messages))
+	for _, message := range messages {
+		msg, err := toChatMessageDoc(message)
+		if err != nil {
+			return err
+		}
+
+		docs = append(docs, msg)
+	}
+
+	return h.write(ctx, bson.D{{Key: "messages", Value: docs}}, nil)
+}
+
+// Metadata returns the metadata stored for the session.
+func (h *ChatHistory) Metadata(ctx context.Context) (map[string]any, error) {
+	session, err := h.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return session.Metadata, nil
+}
+
+// SetMetadata merges the specified values into the metadata for the session.
+func (h *ChatHistory) SetMetadata(ctx context.Context, metadata map[string]any) error {
+	set := bson.D{}
+	for k, v := range metadata {
+		set = append(set, bson.E{Key: "metadata." + k, Value: v})
+	}
+
+	if len(set) == 0 {
+		return nil
+	}
+
+	return h.write(ctx, set, nil)
+}
+
+// =============================================================================
+
+type chatMessageDoc struct {
+	Type    string    `bson:"type"`
+	Content string    `bson:"content"`
+	Name    string    `bson:"name,omitempty"`
+	Role    string    `bson:"role,omitempty"`
+	ID      string    `bson:"id,omitempty"`
+	Created time.Time `bson:"created"`
+}
+
+type chatSessionDoc struct {
+	Messages []chatMessageDoc `bson:"messages"`
+	Metadata map[string]any   `bson:"metadata"`
+}
+
+func (h *ChatHistory) session(ctx context.Context) (chatSessionDoc, error) {
+	var session chatSessionDoc
+
+	err := h.col.FindOne(ctx, bson.D{{Key: "_id", Value: h.sessionID}}).Decode(&session)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return chatSessionDoc{}, nil
+	case err != nil:
+		return chatSessionDoc{}, fmt.Errorf("find: %w", err)
+	}
+
+	return session, nil
+}
+
+// write applies the set and push operations to the session document,
+// creating it if needed and pushing out or removing the expiry.
+func (h *ChatHistory) write(ctx context.Context, set bson.D, push bson.D) error {
+	now := time.Now().UTC()
+
+	set = append(set, bson.E{Key: "updated", Value: now})
+	if h.ttl > 0 {
+		set = append(set, bson.E{Key: "expires", Value: now.Add(h.ttl)})
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "created", Value: now}}},
+	}
+
+	// An expiry left by an earlier TTL would still let the index delete the
+	// session.
+	if h.ttl <= 0 {
+		update = append(update, bson.E{Key: "$unset", Value: bson.D{{Key: "expires", Value: ""}}})
+	}
+
+	if len(push) > 0 {
+		update = append(update, bson.E{Key: "$push", Value: push})
+	}
+
+	filter := bson.D{{Key: "_id", Value: h.sessionID}}
+	if _, err := h.col.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+func toChatMessageDoc(message llms.ChatMessage) (chatMessageDoc, error) {
+	msg := chatMessageDoc{
+		Type:    string(message.GetType()),
+		Content: message.GetContent(),
+		Created: time.Now().UTC(),
+	}
+
+	switch m := message.(type) {
+	case llms.GenericChatMessage:
+		msg.Role = m.Role
+		msg.Name = m.Name
+	case llms.FunctionChatMessage:
+		msg.Name = m.Name
+	case llms.ToolChatMessage:
+		msg.ID = m.ID
+	case llms.AIChatMessage, llms.HumanChatMessage, llms.SystemChatMessage:
+	default:
+		return chatMessageDoc{}, fmt.Errorf("%w: %T", llms.ErrUnexpectedChatMessageType, message)
+	}
+
+	return msg, nil
+}
+
+func (msg chatMessageDoc) toChatMessage() (llms.ChatMessage, error) {
+	switch llms.ChatMessageType(msg.Type) {
+	case llms.ChatMessageTypeAI:
+		return llms.AIChatMessage{Content: msg.Content}, nil
+	case llms.ChatMessageTypeHuman:
+		return llms.HumanChatMessage{Content: msg.Content}, nil
+	case llms.ChatMessageTypeSystem:
+		return llms.SystemChatMessage{Content: msg.Content}, nil
+	case llms.ChatMessageTypeGeneric:
+		return llms.GenericChatMessage{Content: msg.Content, Role: msg.Role, Name: msg.Name}, nil
+	case llms.ChatMessageTypeFunction:
+		return llms.FunctionChatMessage{Content: msg.Content, Name: msg.Name}, nil
+	case llms.ChatMessageTypeTool:
+		return llms.ToolChatMessage{Content: msg.Content, ID: msg.ID}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", llms.ErrUnexpectedChatMessageType, msg.Type)
+}
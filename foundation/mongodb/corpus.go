@@ -0,0 +1,411 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Corpus represents a set of documents that are embedded and searched
+// together, such as a book or a set of internal docs.
+type Corpus struct {
+	Name        string         `bson:"_id"`
+	Database    string         `bson:"database"`
+	Collection  string         `bson:"collection"`
+	VectorIndex string         `bson:"vector_index"`
+	Path        string         `bson:"path"`
+	Similarity  string         `bson:"similarity"`
+	Model       EmbeddingModel `bson:"model"`
+	Created     time.Time      `bson:"created"`
+
+	// TextKey represents the document field that holds the text.
+	// Ex: text
+	TextKey string `bson:"text_key"`
+
+	// UniqueKey represents the document field given a unique index, so
+	// documents can be upserted by it. Empty creates no unique index.
+	// Ex: id
+	UniqueKey string `bson:"unique_key"`
+}
+
+// CorporaConfig represents the settings required to construct a corpora
+// registry.
+type CorporaConfig struct {
+	Client *mongo.Client
+
+	// Registry represents the collection that records every corpus.
+	Registry *mongo.Collection
+
+	// EmbedderFor returns the embedder for the specified model. It's used to
+	// embed queries for the corpora being searched.
+	EmbedderFor func(model EmbeddingModel) (Embedder, error)
+
+	// Embeddings represents the collection, in the database of every corpus,
+	// holding the active embedding of the corpus collection as switched by
+	// MigrateEmbeddings. Searches follow its model, path and index.
+	// Ex: embeddings
+	Embeddings string
+}
+
+// Corpora provisions and routes queries to the registered corpora.
+type Corpora struct {
+	client      *mongo.Client
+	registry    *mongo.Collection
+	embedderFor func(model EmbeddingModel) (Embedder, error)
+	embeddings  string
+
+	mu        sync.Mutex
+	embedders map[EmbeddingModel]Embedder
+}
+
+// NewCorpora constructs a corpora registry for use.
+func NewCorpora(cfg CorporaConfig) (*Corpora, error) {
+	if cfg.Client == nil || cfg.Registry == nil {
+		return nil, errors.New("client and registry are required")
+	}
+
+	if cfg.EmbedderFor == nil {
+		return nil, errors.New("embedderFor is required")
+	}
+
+	c := Corpora{
+		client:      cfg.Client,
+		registry:    cfg.Registry,
+		embedderFor: cfg.EmbedderFor,
+		embeddings:  cfg.Embeddings,
+		embedders:   make(map[EmbeddingModel]Embedder),
+	}
+
+	if c.embeddings == "" {
+		c.embeddings = "embeddings"
+	}
+
+	return &c, nil
+}
+
+// Provision creates the collection, vector index and unique index for the
+// corpus and records it in the registry. The corpus embedding becomes the
+// active embedding of the collection unless one is already active, so a
+// completed migration is never reverted. Provisioning an existing corpus is
+// allowed as long as its embedding model and storage haven't changed.
+func (c *Corpora) Provision(ctx context.Context, corpus Corpus) (*mongo.Collection, error) {
+	if corpus.Name == "" || corpus.Database == "" {
+		return nil, errors.New("corpus name and database are required")
+	}
+
+	if corpus.Model.Name == "" || corpus.Model.Dimensions <= 0 {
+		return nil, errors.New("corpus model name and dimensions are required")
+	}
+
+	if corpus.Collection == "" {
+		corpus.Collection = corpus.Name
+	}
+
+	if corpus.VectorIndex == "" {
+		corpus.VectorIndex = "vector_index"
+	}
+
+	if corpus.Path == "" {
+		corpus.Path = "embedding"
+	}
+
+	if corpus.Similarity == "" {
+		corpus.Similarity = "cosine"
+	}
+
+	if corpus.TextKey == "" {
+		corpus.TextKey = "text"
+	}
+
+	existing, err := c.Lookup(ctx, corpus.Name)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+	case err != nil:
+		return nil, fmt.Errorf("lookup: %w", err)
+	case existing.Model != corpus.Model:
+		return nil, fmt.Errorf("corpus %q is embedded with %s (%d dims, v%d), not %s (%d dims, v%d)",
+			corpus.Name,
+			existing.Model.Name, existing.Model.Dimensions, existing.Model.Version,
+			corpus.Model.Name, corpus.Model.Dimensions, corpus.Model.Version)
+	case existing.Database != corpus.Database || existing.Collection != corpus.Collection:
+		return nil, fmt.Errorf("corpus %q is stored in %s.%s, not %s.%s",
+			corpus.Name, existing.Database, existing.Collection, corpus.Database, corpus.Collection)
+	case existing.VectorIndex != corpus.VectorIndex || existing.Path != corpus.Path || existing.Similarity != corpus.Similarity:
+		return nil, fmt.Errorf("corpus %q is indexed by %s on %s with %s, not %s on %s with %s",
+			corpus.Name, existing.VectorIndex, existing.Path, existing.Similarity,
+			corpus.VectorIndex, corpus.Path, corpus.Similarity)
+	}
+
+	db := c.client.Database(corpus.Database)
+
+	col, err := CreateCollection(ctx, db, corpus.Collection)
+	if err != nil {
+		return nil, fmt.Errorf("createCollection: %w", err)
+	}
+
+	settings := VectorIndexSettings{
+		NumDimensions: corpus.Model.Dimensions,
+		Path:          corpus.Path,
+		Similarity:    corpus.Similarity,
+	}
+
+	if err := CreateVectorIndex(ctx, col, corpus.VectorIndex, settings); err != nil {
+		return nil, fmt.Errorf("createVectorIndex: %w", err)
+	}
+
+	if corpus.UniqueKey != "" {
+		indexModel := mongo.IndexModel{
+			Keys:    bson.D{{Key: corpus.UniqueKey, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}
+
+		if _, err := col.Indexes().CreateOne(ctx, indexModel); err != nil {
+			return nil, fmt.Errorf("create unique index: %w", err)
+		}
+	}
+
+	registry := c.embeddingsRegistry(corpus)
+
+	if _, err := ActiveEmbedding(ctx, registry, corpus.Collection); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("activeEmbedding: %w", err)
+		}
+
+		if err := SetActiveEmbedding(ctx, registry, corpus.Collection, corpus.target()); err != nil {
+			return nil, fmt.Errorf("setActiveEmbedding: %w", err)
+		}
+	}
+
+	corpus.Created = time.Now().UTC()
+
+	filter := bson.D{{Key: "_id", Value: corpus.Name}}
+	update := bson.D{{Key: "$setOnInsert", Value: corpus}}
+
+	if _, err := c.registry.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return nil, fmt.Errorf("register: %w", err)
+	}
+
+	return col, nil
+}
+
+// Lookup returns the registered corpus with the specified name.
+func (c *Corpora) Lookup(ctx context.Context, name string) (Corpus, error) {
+	var corpus Corpus
+	if err := c.registry.FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Decode(&corpus); err != nil {
+		return Corpus{}, fmt.Errorf("find: %w", err)
+	}
+
+	return corpus, nil
+}
+
+// List returns every registered corpus.
+func (c *Corpora) List(ctx context.Context) ([]Corpus, error) {
+	cur, err := c.registry.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var corpora []Corpus
+	if err := cur.All(ctx, &corpora); err != nil {
+		return nil, fmt.Errorf("all: %w", err)
+	}
+
+	return corpora, nil
+}
+
+// Collection returns the collection that holds the documents for the corpus.
+func (c *Corpora) Collection(corpus Corpus) *mongo.Collection {
+	return c.client.Database(corpus.Database).Collection(corpus.Collection)
+}
+
+// Search performs a vector search for the query across the named corpora.
+// A single name routes the query to that corpus; several names fan the
+// query out and merge the results by score. Every corpus is searched with
+// its active embedding, which a migration can have moved to another model,
+// path and index. Scores are only comparable when they come from the same
+// model and similarity function, so the corpora must share both. Each
+// document's metadata has a corpus field naming the corpus it came from.
+func (c *Corpora) Search(ctx context.Context, names []string, query string, limit int, numCandidates int) ([]schema.Document, error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least one corpus is required")
+	}
+
+	if limit <= 0 {
+		return nil, errors.New("limit must be greater than zero")
+	}
+
+	routes := make([]corpusRoute, len(names))
+	for i, name := range names {
+		route, err := c.route(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", name, err)
+		}
+
+		if first := routes[0]; i > 0 && (route.target.Model != first.target.Model || route.corpus.Similarity != first.corpus.Similarity) {
+			return nil, fmt.Errorf("corpus %q uses %s with %s, corpus %q uses %s with %s: scores can't be merged",
+				first.corpus.Name, first.target.Model.Name, first.corpus.Similarity,
+				route.corpus.Name, route.target.Model.Name, route.corpus.Similarity)
+		}
+
+		routes[i] = route
+	}
+
+	embedding, err := c.embed(ctx, routes[0].target.Model, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed: %w", err)
+	}
+
+	results := make([][]schema.Document, len(routes))
+	errs := make([]error, len(routes))
+
+	var wg sync.WaitGroup
+	wg.Add(len(routes))
+
+	for i, route := range routes {
+		go func(i int, route corpusRoute) {
+			defer wg.Done()
+
+			corpus := route.corpus
+
+			settings := VectorSearchSettings{
+				IndexName:     route.target.IndexName,
+				Path:          route.target.Path,
+				NumCandidates: numCandidates,
+				Limit:         limit,
+				ExcludePaths:  route.paths,
+			}
+
+			var res []bson.M
+			if err := VectorSearch(ctx, c.Collection(corpus), settings, embedding, &res); err != nil {
+				errs[i] = fmt.Errorf("vectorSearch %q: %w", corpus.Name, err)
+				return
+			}
+
+			textKey := corpus.TextKey
+			if textKey == "" {
+				textKey = "text"
+			}
+
+			docs := make([]schema.Document, len(res))
+			for j, r := range res {
+				docs[j] = toDocument(r, textKey, route.target.Path)
+				docs[j].Metadata["corpus"] = corpus.Name
+			}
+
+			results[i] = docs
+		}(i, route)
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var docs []schema.Document
+	for _, res := range results {
+		docs = append(docs, res...)
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].Score > docs[j].Score
+	})
+
+	if len(docs) > limit {
+		docs = docs[:limit]
+	}
+
+	return docs, nil
+}
+
+// =============================================================================
+
+// corpusRoute represents a corpus together with the embedding target its
+// queries are searched with and every path embeddings were written to.
+type corpusRoute struct {
+	corpus Corpus
+	target EmbeddingTarget
+	paths  []string
+}
+
+// route looks up the corpus and its active embedding. A corpus provisioned
+// before the embeddings registry existed is searched as it was provisioned.
+func (c *Corpora) route(ctx context.Context, name string) (corpusRoute, error) {
+	corpus, err := c.Lookup(ctx, name)
+	if err != nil {
+		return corpusRoute{}, fmt.Errorf("lookup: %w", err)
+	}
+
+	route := corpusRoute{
+		corpus: corpus,
+		target: corpus.target(),
+	}
+
+	entry, err := lookupEmbeddings(ctx, c.embeddingsRegistry(corpus), corpus.Collection)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return route, nil
+	case err != nil:
+		return corpusRoute{}, fmt.Errorf("lookupEmbeddings: %w", err)
+	}
+
+	route.paths = entry.Paths
+	if entry.Active.Path != "" {
+		route.target = entry.Active
+	}
+
+	return route, nil
+}
+
+func (c *Corpora) embeddingsRegistry(corpus Corpus) *mongo.Collection {
+	return c.client.Database(corpus.Database).Collection(c.embeddings)
+}
+
+// target returns the embedding target the corpus was provisioned with.
+func (corpus Corpus) target() EmbeddingTarget {
+	return EmbeddingTarget{
+		Model:     corpus.Model,
+		Path:      corpus.Path,
+		IndexName: corpus.VectorIndex,
+	}
+}
+
+func (c *Corpora) embed(ctx context.Context, model EmbeddingModel, query string) ([]float32, error) {
+	c.mu.Lock()
+	embedder, exists := c.embedders[model]
+	if !exists {
+		var err error
+		embedder, err = c.embedderFor(model)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("embedderFor: %w", err)
+		}
+
+		c.embedders[model] = embedder
+	}
+	c.mu.Unlock()
+
+	embedding, err := embedder.CreateEmbedding(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("create embedding: %w", err)
+	}
+
+	if len(embedding) == 0 {
+		return nil, errors.New("no embedding returned")
+	}
+
+	if len(embedding[0]) != model.Dimensions {
+		return nil, fmt.Errorf("model %q returned %d dimensions, expected %d", model.Name, len(embedding[0]), model.Dimensions)
+	}
+
+	return embedding[0], nil
+}
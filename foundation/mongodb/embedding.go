@@ -0,0 +1,254 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmbeddingModel represents the model that produced an embedding. Every
+// stored embedding is tagged with this information so vectors from different
+// models are never mixed in the same search.
+type EmbeddingModel struct {
+	Name       string `bson:"name"`
+	Dimensions int    `bson:"dimensions"`
+	Version    int    `bson:"version"`
+}
+
+// EmbeddingTarget represents where the embeddings for a model are stored
+// and which vector index searches them.
+type EmbeddingTarget struct {
+	Model     EmbeddingModel `bson:"model"`
+	Path      string         `bson:"path"`
+	IndexName string         `bson:"index_name"`
+}
+
+// ModelKey returns the document field that holds the model tag for the
+// embedding stored at the specified path.
+func ModelKey(path string) string {
+	return path + "_model"
+}
+
+// ActiveEmbedding returns the embedding target readers should use for the
+// specified collection. The error wraps mongo.ErrNoDocuments when no target
+// is active yet.
+func ActiveEmbedding(ctx context.Context, registry *mongo.Collection, collectionName string) (EmbeddingTarget, error) {
+	entry, err := lookupEmbeddings(ctx, registry, collectionName)
+	if err != nil {
+		return EmbeddingTarget{}, err
+	}
+
+	// The entry can only hold the shadow field of a running migration.
+	if entry.Active.Path == "" {
+		return EmbeddingTarget{}, fmt.Errorf("find: %w", mongo.ErrNoDocuments)
+	}
+
+	return entry.Active, nil
+}
+
+// SetActiveEmbedding switches readers of the specified collection to the
+// embedding target. This is a single document write so the switch is atomic.
+func SetActiveEmbedding(ctx context.Context, registry *mongo.Collection, collectionName string, target EmbeddingTarget) error {
+	filter := bson.D{{Key: "_id", Value: collectionName}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "active", Value: target},
+			{Key: "updated", Value: time.Now().UTC()},
+		}},
+		{Key: "$addToSet", Value: bson.D{{Key: "paths", Value: target.Path}}},
+	}
+
+	if _, err := registry.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+// embeddingEntry represents the registry document of a collection. Paths
+// holds every path embeddings were written to, so searches can leave the
+// shadow fields of the other models out of their results.
+type embeddingEntry struct {
+	Active EmbeddingTarget `bson:"active"`
+	Paths  []string        `bson:"paths"`
+}
+
+func lookupEmbeddings(ctx context.Context, registry *mongo.Collection, collectionName string) (embeddingEntry, error) {
+	var entry embeddingEntry
+	if err := registry.FindOne(ctx, bson.D{{Key: "_id", Value: collectionName}}).Decode(&entry); err != nil {
+		return embeddingEntry{}, fmt.Errorf("find: %w", err)
+	}
+
+	return entry, nil
+}
+
+// addEmbeddingPath records a path embeddings are written to without
+// changing the active embedding.
+func addEmbeddingPath(ctx context.Context, registry *mongo.Collection, collectionName string, path string) error {
+	filter := bson.D{{Key: "_id", Value: collectionName}}
+	update := bson.D{{Key: "$addToSet", Value: bson.D{{Key: "paths", Value: path}}}}
+
+	if _, err := registry.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// MigrationConfig represents the settings required to re-embed a collection
+// with a new embedding model.
+type MigrationConfig struct {
+	Collection *mongo.Collection
+	Registry   *mongo.Collection
+	Embedder   Embedder
+
+	// Target represents the new model along with the shadow field and vector
+	// index the new embeddings will be written to. The path must be different
+	// from the active path so readers are not affected during the migration.
+	Target EmbeddingTarget
+
+	// Similarity represents the similarity function for the new vector index.
+	// Ex: cosine
+	Similarity string
+
+	// TextKey represents the document field that holds the text to embed.
+	// Ex: text
+	TextKey string
+
+	// Progress is called after each document is embedded. It's optional.
+	Progress func(embedded int)
+}
+
+// MigrateEmbeddings re-embeds every document in the collection into the
+// target's shadow field, builds the new vector index, and then switches
+// readers over to the target. Documents already tagged with the target model
+// are skipped, so an interrupted migration can be run again.
+func MigrateEmbeddings(ctx context.Context, cfg MigrationConfig) error {
+	if cfg.Collection == nil || cfg.Registry == nil || cfg.Embedder == nil {
+		return errors.New("collection, registry and embedder are required")
+	}
+
+	if cfg.Target.Path == "" || cfg.Target.IndexName == "" {
+		return errors.New("target path and index name are required")
+	}
+
+	if cfg.Target.Model.Name == "" || cfg.Target.Model.Dimensions <= 0 {
+		return errors.New("target model name and dimensions are required")
+	}
+
+	active, err := ActiveEmbedding(ctx, cfg.Registry, cfg.Collection.Name())
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+	case err != nil:
+		return fmt.Errorf("activeEmbedding: %w", err)
+	case active.Path == cfg.Target.Path:
+		return fmt.Errorf("target path %q is the active path", cfg.Target.Path)
+	}
+
+	textKey := cfg.TextKey
+	if textKey == "" {
+		textKey = "text"
+	}
+
+	// The shadow field is recorded first, so searches leave it out while it's
+	// being written.
+	if err := addEmbeddingPath(ctx, cfg.Registry, cfg.Collection.Name(), cfg.Target.Path); err != nil {
+		return fmt.Errorf("addEmbeddingPath: %w", err)
+	}
+
+	if err := reembed(ctx, cfg, textKey); err != nil {
+		return fmt.Errorf("reembed: %w", err)
+	}
+
+	settings := VectorIndexSettings{
+		NumDimensions: cfg.Target.Model.Dimensions,
+		Path:          cfg.Target.Path,
+		Similarity:    cfg.Similarity,
+	}
+
+	if err := CreateVectorIndex(ctx, cfg.Collection, cfg.Target.IndexName, settings); err != nil {
+		return fmt.Errorf("createVectorIndex: %w", err)
+	}
+
+	if err := WaitForSearchIndex(ctx, cfg.Collection, cfg.Target.IndexName); err != nil {
+		return fmt.Errorf("waitForSearchIndex: %w", err)
+	}
+
+	if err := SetActiveEmbedding(ctx, cfg.Registry, cfg.Collection.Name(), cfg.Target); err != nil {
+		return fmt.Errorf("setActiveEmbedding: %w", err)
+	}
+
+	return nil
+}
+
+func reembed(ctx context.Context, cfg MigrationConfig, textKey string) error {
+	modelKey := ModelKey(cfg.Target.Path)
+
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: modelKey + ".name", Value: bson.D{{Key: "$ne", Value: cfg.Target.Model.Name}}}},
+		bson.D{{Key: modelKey + ".version", Value: bson.D{{Key: "$ne", Value: cfg.Target.Model.Version}}}},
+	}}}
+
+	projection := bson.D{{Key: textKey, Value: 1}}
+
+	cur, err := cfg.Collection.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var embedded int
+
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return fmt.Errorf("decode: %w", err)
+		}
+
+		text, ok := doc[textKey].(string)
+		if !ok || text == "" {
+			continue
+		}
+
+		embedding, err := cfg.Embedder.CreateEmbedding(ctx, []string{text})
+		if err != nil {
+			return fmt.Errorf("create embedding: %w", err)
+		}
+
+		if len(embedding) == 0 {
+			return errors.New("no embedding returned")
+		}
+
+		if len(embedding[0]) != cfg.Target.Model.Dimensions {
+			return fmt.Errorf("model %q returned %d dimensions, expected %d", cfg.Target.Model.Name, len(embedding[0]), cfg.Target.Model.Dimensions)
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: cfg.Target.Path, Value: embedding[0]},
+			{Key: modelKey, Value: cfg.Target.Model},
+		}}}
+
+		if _, err := cfg.Collection.UpdateByID(ctx, doc["_id"], update); err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+
+		embedded++
+
+		if cfg.Progress != nil {
+			cfg.Progress(embedded)
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("cursor: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,499 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmbedWorkerConfig represents the settings required to construct an
+// embedding worker.
+type EmbedWorkerConfig struct {
+	Collection *mongo.Collection
+	Embedder   Embedder
+
+	// Model represents the model used by the embedder. Every embedding the
+	// worker writes is tagged with this information.
+	Model EmbeddingModel
+
+	// Tokens represents the collection used to persist the change stream
+	// resume token so a restart picks up where the worker left off.
+	Tokens *mongo.Collection
+
+	// Name represents the unique name of the worker. It's used as the key
+	// for the persisted resume token.
+	// Ex: book-embedder
+	Name string
+
+	// TextKey represents the document field that holds the text to embed.
+	// Ex: text
+	TextKey string
+
+	// EmbeddingKey represents the document field to write the embedding to.
+	// Ex: embedding
+	EmbeddingKey string
+
+	// MaxConcurrency represents the number of documents that can be embedded
+	// at the same time.
+	// Ex: 4
+	MaxConcurrency int
+
+	// MaxRetries represents the number of times to retry embedding a
+	// document before giving up on it.
+	// Ex: 3
+	MaxRetries int
+
+	// RetryDelay represents the initial delay between retries. The delay
+	// doubles after every attempt.
+	// Ex: 500ms
+	RetryDelay time.Duration
+
+	// OnError is called when a document can't be embedded after all the
+	// retries are exhausted. The document is marked as failed and retried
+	// the next time the worker starts. It's optional.
+	OnError func(docID any, err error)
+}
+
+// EmbedWorker watches a collection's change stream and keeps the embedding
+// of every inserted or updated document current.
+type EmbedWorker struct {
+	col            *mongo.Collection
+	embedder       Embedder
+	model          EmbeddingModel
+	tokens         *mongo.Collection
+	name           string
+	textKey        string
+	embeddingKey   string
+	hashKey        string
+	errorKey       string
+	maxConcurrency int
+	maxRetries     int
+	retryDelay     time.Duration
+	onError        func(docID any, err error)
+}
+
+// NewEmbedWorker constructs an embedding worker for use.
+func NewEmbedWorker(cfg EmbedWorkerConfig) (*EmbedWorker, error) {
+	if cfg.Collection == nil || cfg.Tokens == nil {
+		return nil, errors.New("collection and tokens collection are required")
+	}
+
+	if cfg.Embedder == nil {
+		return nil, errors.New("embedder is required")
+	}
+
+	if cfg.Name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	if cfg.Model.Name == "" || cfg.Model.Dimensions <= 0 {
+		return nil, errors.New("model name and dimensions are required")
+	}
+
+	w := EmbedWorker{
+		col:            cfg.Collection,
+		embedder:       cfg.Embedder,
+		model:          cfg.Model,
+		tokens:         cfg.Tokens,
+		name:           cfg.Name,
+		textKey:        cfg.TextKey,
+		embeddingKey:   cfg.EmbeddingKey,
+		maxConcurrency: cfg.MaxConcurrency,
+		maxRetries:     cfg.MaxRetries,
+		retryDelay:     cfg.RetryDelay,
+		onError:        cfg.OnError,
+	}
+
+	if w.textKey == "" {
+		w.textKey = "text"
+	}
+
+	if w.embeddingKey == "" {
+		w.embeddingKey = "embedding"
+	}
+
+	if w.maxConcurrency <= 0 {
+		w.maxConcurrency = 1
+	}
+
+	if w.retryDelay <= 0 {
+		w.retryDelay = 500 * time.Millisecond
+	}
+
+	w.hashKey = w.embeddingKey + "_hash"
+	w.errorKey = w.embeddingKey + "_error"
+
+	return &w, nil
+}
+
+// Run embeds any documents that are missing an embedding, failed to embed or
+// are tagged with a different model and then watches the change stream until the context is done. Events are
+// processed in batches of at most MaxConcurrency documents and the resume
+// token is saved after every batch completes.
+func (w *EmbedWorker) Run(ctx context.Context) error {
+	token, err := w.loadResumeToken(ctx)
+	if err != nil {
+		return fmt.Errorf("loadResumeToken: %w", err)
+	}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+
+	// The stream is opened before the backfill so documents written while
+	// the backfill runs are delivered as events once it's done.
+	stream, err := w.col.Watch(ctx, w.watchPipeline(), opts)
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	defer stream.Close(context.Background())
+
+	if err := w.backfill(ctx); err != nil {
+		return fmt.Errorf("backfill: %w", err)
+	}
+
+	for stream.Next(ctx) {
+		batch := make([]bson.M, 0, w.maxConcurrency)
+
+		for {
+			var event struct {
+				FullDocument bson.M `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&event); err != nil {
+				return fmt.Errorf("decode: %w", err)
+			}
+
+			if event.FullDocument != nil {
+				batch = append(batch, event.FullDocument)
+			}
+
+			if len(batch) == w.maxConcurrency || stream.RemainingBatchLength() == 0 {
+				break
+			}
+
+			if !stream.TryNext(ctx) {
+				break
+			}
+		}
+
+		// Documents written while the backfill ran were already embedded by
+		// it, their events are left out instead of being embedded twice.
+		batch, err := w.pending(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("pending: %w", err)
+		}
+
+		// A failure that can't be recorded on the document must not be
+		// skipped over by the resume token.
+		if err := w.embedBatch(ctx, batch); err != nil {
+			return fmt.Errorf("embedBatch: %w", err)
+		}
+
+		if err := w.saveResumeToken(ctx, stream.ResumeToken()); err != nil {
+			return fmt.Errorf("saveResumeToken: %w", err)
+		}
+	}
+
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("stream: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+func (w *EmbedWorker) watchPipeline() mongo.Pipeline {
+
+	// Only updates that touch the text field are interesting. This keeps the
+	// worker from reacting to its own embedding writes.
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"insert", "replace"}}}}},
+				bson.D{
+					{Key: "operationType", Value: "update"},
+					{Key: "updateDescription.updatedFields." + w.textKey, Value: bson.D{{Key: "$exists", Value: true}}},
+				},
+			}},
+		}}},
+	}
+}
+
+// backfill embeds the documents that are missing an embedding, failed to
+// embed or are tagged with a different model.
+func (w *EmbedWorker) backfill(ctx context.Context) error {
+	modelKey := ModelKey(w.embeddingKey)
+
+	filter := bson.D{
+		{Key: w.textKey, Value: bson.D{{Key: "$type", Value: "string"}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: w.embeddingKey, Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: w.errorKey, Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: modelKey + ".name", Value: bson.D{{Key: "$ne", Value: w.model.Name}}}},
+			bson.D{{Key: modelKey + ".dimensions", Value: bson.D{{Key: "$ne", Value: w.model.Dimensions}}}},
+			bson.D{{Key: modelKey + ".version", Value: bson.D{{Key: "$ne", Value: w.model.Version}}}},
+		}},
+	}
+
+	cur, err := w.col.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	batch := make([]bson.M, 0, w.maxConcurrency)
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return fmt.Errorf("decode: %w", err)
+		}
+
+		batch = append(batch, doc)
+		if len(batch) == w.maxConcurrency {
+			if err := w.embedBatch(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("cursor: %w", err)
+	}
+
+	return w.embedBatch(ctx, batch)
+}
+
+// pending returns the documents of the batch whose stored embedding isn't
+// current for their text. The change stream delivers the document as it was
+// written, so the embedding state is read again.
+func (w *EmbedWorker) pending(ctx context.Context, batch []bson.M) ([]bson.M, error) {
+	if len(batch) == 0 {
+		return batch, nil
+	}
+
+	ids := make(bson.A, len(batch))
+	for i, doc := range batch {
+		ids[i] = doc["_id"]
+	}
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	projection := bson.D{
+		{Key: w.hashKey, Value: 1},
+		{Key: w.errorKey, Value: 1},
+		{Key: ModelKey(w.embeddingKey), Value: 1},
+	}
+
+	cur, err := w.col.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var stored []bson.M
+	if err := cur.All(ctx, &stored); err != nil {
+		return nil, fmt.Errorf("all: %w", err)
+	}
+
+	current := make(map[any]bson.M, len(stored))
+	for _, doc := range stored {
+		current[doc["_id"]] = doc
+	}
+
+	pending := batch[:0]
+	for _, doc := range batch {
+		text, _ := doc[w.textKey].(string)
+
+		state, exists := current[doc["_id"]]
+		if exists && state[w.hashKey] == contentHash(text) && w.taggedWithModel(state) && state[w.errorKey] == nil {
+			continue
+		}
+
+		pending = append(pending, doc)
+	}
+
+	return pending, nil
+}
+
+// embedBatch embeds the documents at the same time. A document that can't be
+// embedded is marked as failed so the next backfill retries it. An error is
+// only returned when that mark can't be written.
+func (w *EmbedWorker) embedBatch(ctx context.Context, batch []bson.M) error {
+	var wg sync.WaitGroup
+	wg.Add(len(batch))
+
+	errs := make([]error, len(batch))
+
+	for i, doc := range batch {
+		go func(i int, doc bson.M) {
+			defer wg.Done()
+
+			err := w.embedWithRetry(ctx, doc)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+
+			if w.onError != nil {
+				w.onError(doc["_id"], err)
+			}
+
+			errs[i] = w.markFailed(ctx, doc, err)
+		}(i, doc)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (w *EmbedWorker) embedWithRetry(ctx context.Context, doc bson.M) error {
+	delay := w.retryDelay
+
+	var err error
+	for attempt := 0; attempt <= w.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+		}
+
+		if err = w.embed(ctx, doc); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("embed after %d retries: %w", w.maxRetries, err)
+}
+
+func (w *EmbedWorker) embed(ctx context.Context, doc bson.M) error {
+	text, ok := doc[w.textKey].(string)
+	if !ok || text == "" {
+		return nil
+	}
+
+	// If the hash of the text matches what was last embedded, the embedding
+	// is already current.
+	hash := contentHash(text)
+	if current, ok := doc[w.hashKey].(string); ok && current == hash && w.taggedWithModel(doc) && doc[w.errorKey] == nil {
+		return nil
+	}
+
+	embedding, err := w.embedder.CreateEmbedding(ctx, []string{text})
+	if err != nil {
+		return fmt.Errorf("create embedding: %w", err)
+	}
+
+	if len(embedding) == 0 {
+		return errors.New("no embedding returned")
+	}
+
+	if len(embedding[0]) != w.model.Dimensions {
+		return fmt.Errorf("model %q returned %d dimensions, expected %d", w.model.Name, len(embedding[0]), w.model.Dimensions)
+	}
+
+	filter := bson.D{{Key: "_id", Value: doc["_id"]}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: w.embeddingKey, Value: embedding[0]},
+			{Key: w.hashKey, Value: hash},
+			{Key: ModelKey(w.embeddingKey), Value: w.model},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: w.errorKey, Value: ""}}},
+	}
+
+	if _, err := w.col.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+func (w *EmbedWorker) markFailed(ctx context.Context, doc bson.M, embedErr error) error {
+	filter := bson.D{{Key: "_id", Value: doc["_id"]}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: w.errorKey, Value: embedErr.Error()},
+	}}}
+
+	if _, err := w.col.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("mark %v failed: %w", doc["_id"], err)
+	}
+
+	return nil
+}
+
+func (w *EmbedWorker) taggedWithModel(doc bson.M) bool {
+	tag, ok := doc[ModelKey(w.embeddingKey)]
+	if !ok {
+		return false
+	}
+
+	data, err := bson.Marshal(tag)
+	if err != nil {
+		return false
+	}
+
+	var model EmbeddingModel
+	if err := bson.Unmarshal(data, &model); err != nil {
+		return false
+	}
+
+	return model == w.model
+}
+
+func (w *EmbedWorker) loadResumeToken(ctx context.Context) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+
+	err := w.tokens.FindOne(ctx, bson.D{{Key: "_id", Value: w.name}}).Decode(&doc)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("find: %w", err)
+	}
+
+	return doc.Token, nil
+}
+
+func (w *EmbedWorker) saveResumeToken(ctx context.Context, token bson.Raw) error {
+
+	// The batch is replayed on the next start, so a shutdown in the middle
+	// of saving is not an error.
+	if token == nil || ctx.Err() != nil {
+		return nil
+	}
+
+	filter := bson.D{{Key: "_id", Value: w.name}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "token", Value: token},
+		{Key: "updated", Value: time.Now().UTC()},
+	}}}
+
+	if _, err := w.tokens.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+// contentHash returns a stable hash of the text used to detect when an
+// embedding is stale.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,585 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Completer represents behavior for sending a prompt to a language model.
+// The ollama LLM value implements this interface.
+type Completer interface {
+	Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error)
+}
+
+// Entity represents a concept mentioned in the chunks, such as "escape
+// analysis" or "goroutine". The name is normalized and serves as the id.
+type Entity struct {
+	Name        string `bson:"_id" json:"name"`
+	Type        string `bson:"type" json:"type"`
+	Description string `bson:"description" json:"description"`
+	Chunks      []int  `bson:"chunks" json:"-"`
+}
+
+// Relation represents a directed relationship between two entities. Ends
+// holds both entity names so the graph can be walked in either direction.
+type Relation struct {
+	ID     string   `bson:"_id" json:"-"`
+	Source string   `bson:"source" json:"source"`
+	Target string   `bson:"target" json:"target"`
+	Type   string   `bson:"type" json:"type"`
+	Ends   []string `bson:"ends" json:"-"`
+	Chunks []int    `bson:"chunks" json:"-"`
+}
+
+// String returns the relation in a form suitable for a prompt.
+func (r Relation) String() string {
+	return fmt.Sprintf("%s -[%s]-> %s", r.Source, r.Type, r.Target)
+}
+
+// Extraction represents the entities and relations found in a chunk.
+type Extraction struct {
+	Entities  []Entity   `json:"entities"`
+	Relations []Relation `json:"relations"`
+}
+
+// Graph represents a neighborhood of the knowledge graph.
+type Graph struct {
+	Entities  []Entity
+	Relations []Relation
+}
+
+// ExtractGraph asks the model for the entities and relations in the text.
+// Names are normalized and relations that reference an entity the model
+// didn't return are dropped.
+func ExtractGraph(ctx context.Context, llm Completer, text string) (Extraction, error) {
+	prompt := fmt.Sprintf(extractPrompt, text)
+
+	response, err := llm.Call(ctx, prompt, llms.WithTemperature(0))
+	if err != nil {
+		return Extraction{}, fmt.Errorf("call: %w", err)
+	}
+
+	// Models like to wrap the JSON in prose or code fences.
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start == -1 || end < start {
+		return Extraction{}, fmt.Errorf("no json in response: %q", response)
+	}
+
+	var ext Extraction
+	if err := json.Unmarshal([]byte(response[start:end+1]), &ext); err != nil {
+		return Extraction{}, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	entities := make([]Entity, 0, len(ext.Entities))
+	names := make(map[string]bool, len(ext.Entities))
+
+	for _, e := range ext.Entities {
+		e.Name = normalizeEntity(e.Name)
+		if e.Name == "" || names[e.Name] {
+			continue
+		}
+
+		e.Type = strings.ToLower(strings.TrimSpace(e.Type))
+		e.Description = strings.TrimSpace(e.Description)
+		names[e.Name] = true
+		entities = append(entities, e)
+	}
+
+	relations := make([]Relation, 0, len(ext.Relations))
+	for _, r := range ext.Relations {
+		r.Source = normalizeEntity(r.Source)
+		r.Target = normalizeEntity(r.Target)
+		r.Type = strings.ToLower(strings.Join(strings.Fields(r.Type), "_"))
+
+		if !names[r.Source] || !names[r.Target] || r.Source == r.Target || r.Type == "" {
+			continue
+		}
+
+		relations = append(relations, r)
+	}
+
+	ext.Entities = entities
+	ext.Relations = relations
+
+	return ext, nil
+}
+
+// =============================================================================
+
+// GraphStore stores entities and relations that link back to the chunks
+// they were extracted from. Every extracted chunk is recorded in the
+// extractions collection, including chunks without any entities.
+type GraphStore struct {
+	entities    *mongo.Collection
+	relations   *mongo.Collection
+	extractions *mongo.Collection
+}
+
+// NewGraphStore constructs a graph store for use.
+func NewGraphStore(entities *mongo.Collection, relations *mongo.Collection, extractions *mongo.Collection) (*GraphStore, error) {
+	if entities == nil || relations == nil || extractions == nil {
+		return nil, errors.New("entities, relations and extractions collections are required")
+	}
+
+	g := GraphStore{
+		entities:    entities,
+		relations:   relations,
+		extractions: extractions,
+	}
+
+	return &g, nil
+}
+
+// CreateIndexes creates the indexes used to walk the graph and to find the
+// entities for a chunk.
+func (g *GraphStore) CreateIndexes(ctx context.Context) error {
+	if _, err := g.relations.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "ends", Value: 1}}}); err != nil {
+		return fmt.Errorf("create ends index: %w", err)
+	}
+
+	if _, err := g.entities.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "chunks", Value: 1}}}); err != nil {
+		return fmt.Errorf("create entity chunks index: %w", err)
+	}
+
+	if _, err := g.relations.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "chunks", Value: 1}}}); err != nil {
+		return fmt.Errorf("create relation chunks index: %w", err)
+	}
+
+	return nil
+}
+
+// Save records the extraction for the chunk. Entities and relations seen in
+// earlier chunks gain a link to this chunk, so saving is idempotent.
+func (g *GraphStore) Save(ctx context.Context, chunkID int, ext Extraction) error {
+	if len(ext.Entities) > 0 {
+		models := make([]mongo.WriteModel, len(ext.Entities))
+		for i, e := range ext.Entities {
+			update := bson.D{
+				{Key: "$setOnInsert", Value: bson.D{
+					{Key: "type", Value: e.Type},
+					{Key: "description", Value: e.Description},
+				}},
+				{Key: "$addToSet", Value: bson.D{{Key: "chunks", Value: chunkID}}},
+			}
+
+			models[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{Key: "_id", Value: e.Name}}).
+				SetUpdate(update).
+				SetUpsert(true)
+		}
+
+		if _, err := g.entities.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("write entities: %w", err)
+		}
+	}
+
+	if len(ext.Relations) > 0 {
+		models := make([]mongo.WriteModel, len(ext.Relations))
+		for i, r := range ext.Relations {
+			update := bson.D{
+				{Key: "$setOnInsert", Value: bson.D{
+					{Key: "source", Value: r.Source},
+					{Key: "target", Value: r.Target},
+					{Key: "type", Value: r.Type},
+					{Key: "ends", Value: []string{r.Source, r.Target}},
+				}},
+				{Key: "$addToSet", Value: bson.D{{Key: "chunks", Value: chunkID}}},
+			}
+
+			models[i] = mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{Key: "_id", Value: relationID(r)}}).
+				SetUpdate(update).
+				SetUpsert(true)
+		}
+
+		if _, err := g.relations.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("write relations: %w", err)
+		}
+	}
+
+	// The chunk is marked last, so an interrupted save is extracted again.
+	filter := bson.D{{Key: "_id", Value: chunkID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "entities", Value: len(ext.Entities)},
+		{Key: "relations", Value: len(ext.Relations)},
+		{Key: "extracted", Value: time.Now().UTC()},
+	}}}
+
+	if _, err := g.extractions.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("mark extracted: %w", err)
+	}
+
+	return nil
+}
+
+// Extracted reports whether an extraction has been saved for the chunk.
+// Chunks saved before extractions were recorded are found by their
+// entities.
+func (g *GraphStore) Extracted(ctx context.Context, chunkID int) (bool, error) {
+	count, err := g.extractions.CountDocuments(ctx, bson.D{{Key: "_id", Value: chunkID}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("count extractions: %w", err)
+	}
+
+	if count > 0 {
+		return true, nil
+	}
+
+	count, err = g.entities.CountDocuments(ctx, bson.D{{Key: "chunks", Value: chunkID}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("count: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// EntitiesForChunks returns the names of the entities extracted from any of
+// the chunks.
+func (g *GraphStore) EntitiesForChunks(ctx context.Context, chunkIDs []int) ([]string, error) {
+	filter := bson.D{{Key: "chunks", Value: bson.D{{Key: "$in", Value: chunkIDs}}}}
+
+	names, err := g.entities.Distinct(ctx, "_id", filter)
+	if err != nil {
+		return nil, fmt.Errorf("distinct: %w", err)
+	}
+
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		if s, ok := name.(string); ok {
+			result = append(result, s)
+		}
+	}
+
+	return result, nil
+}
+
+// Neighborhood walks the graph from the named entities using $graphLookup
+// and returns every entity and relation within the specified depth. A depth
+// of one returns the relations that touch the named entities.
+func (g *GraphStore) Neighborhood(ctx context.Context, names []string, depth int) (Graph, error) {
+	if len(names) == 0 || depth <= 0 {
+		return Graph{}, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: names}}}}}},
+		{{Key: "$graphLookup", Value: bson.D{
+			{Key: "from", Value: g.relations.Name()},
+			{Key: "startWith", Value: "$_id"},
+			{Key: "connectFromField", Value: "ends"},
+			{Key: "connectToField", Value: "ends"},
+			{Key: "as", Value: "relations"},
+			{Key: "maxDepth", Value: depth - 1},
+		}}},
+		{{Key: "$unwind", Value: "$relations"}},
+		{{Key: "$replaceRoot", Value: bson.D{{Key: "newRoot", Value: "$relations"}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$_id"},
+			{Key: "doc", Value: bson.D{{Key: "$first", Value: "$$ROOT"}}},
+		}}},
+		{{Key: "$replaceRoot", Value: bson.D{{Key: "newRoot", Value: "$doc"}}}},
+	}
+
+	cur, err := g.entities.Aggregate(ctx, pipeline)
+	if err != nil {
+		return Graph{}, fmt.Errorf("aggregate: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var relations []Relation
+	if err := cur.All(ctx, &relations); err != nil {
+		return Graph{}, fmt.Errorf("all relations: %w", err)
+	}
+
+	sort.Slice(relations, func(i, j int) bool {
+		return relations[i].ID < relations[j].ID
+	})
+
+	seen := make(map[string]bool)
+	all := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			all = append(all, name)
+		}
+	}
+
+	for _, r := range relations {
+		for _, name := range r.Ends {
+			if !seen[name] {
+				seen[name] = true
+				all = append(all, name)
+			}
+		}
+	}
+
+	cur, err = g.entities.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: all}}}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return Graph{}, fmt.Errorf("find entities: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var entities []Entity
+	if err := cur.All(ctx, &entities); err != nil {
+		return Graph{}, fmt.Errorf("all entities: %w", err)
+	}
+
+	graph := Graph{
+		Entities:  entities,
+		Relations: relations,
+	}
+
+	return graph, nil
+}
+
+// =============================================================================
+
+// GraphRetrieverConfig represents the settings required to construct a
+// graph retriever.
+type GraphRetrieverConfig struct {
+	// Base represents the vector retriever that finds the seed chunks. The
+	// documents must carry the chunk id in their metadata.
+	Base schema.Retriever
+
+	Graph  *GraphStore
+	Chunks *mongo.Collection
+
+	// ChunkKey represents the document field that holds the chunk id.
+	// Ex: id
+	ChunkKey string
+
+	// TextKey represents the document field that holds the page content.
+	// Ex: text
+	TextKey string
+
+	// Depth represents how many relations away from the seed entities the
+	// graph is walked.
+	// Ex: 2
+	Depth int
+
+	// MaxChunks represents the maximum number of chunks added from the
+	// graph neighborhood on top of the vector results.
+	// Ex: 3
+	MaxChunks int
+}
+
+// GraphRetriever implements the langchaingo schema.Retriever interface. It
+// expands the vector results through the knowledge graph, which answers
+// questions that no single chunk covers.
+type GraphRetriever struct {
+	base      schema.Retriever
+	graph     *GraphStore
+	chunks    *mongo.Collection
+	chunkKey  string
+	textKey   string
+	depth     int
+	maxChunks int
+}
+
+var _ schema.Retriever = (*GraphRetriever)(nil)
+
+// NewGraphRetriever constructs a graph retriever for use.
+func NewGraphRetriever(cfg GraphRetrieverConfig) (*GraphRetriever, error) {
+	if cfg.Base == nil || cfg.Graph == nil || cfg.Chunks == nil {
+		return nil, errors.New("base retriever, graph and chunks collection are required")
+	}
+
+	if cfg.Depth <= 0 {
+		return nil, errors.New("depth must be greater than zero")
+	}
+
+	chunkKey := cfg.ChunkKey
+	if chunkKey == "" {
+		chunkKey = "id"
+	}
+
+	textKey := cfg.TextKey
+	if textKey == "" {
+		textKey = "text"
+	}
+
+	r := GraphRetriever{
+		base:      cfg.Base,
+		graph:     cfg.Graph,
+		chunks:    cfg.Chunks,
+		chunkKey:  chunkKey,
+		textKey:   textKey,
+		depth:     cfg.Depth,
+		maxChunks: cfg.MaxChunks,
+	}
+
+	return &r, nil
+}
+
+// GetRelevantDocuments returns the vector results, followed by a document
+// describing the relations in the graph neighborhood of those results, and
+// then the chunks most connected to that neighborhood.
+func (r *GraphRetriever) GetRelevantDocuments(ctx context.Context, query string) ([]schema.Document, error) {
+	docs, err := r.base.GetRelevantDocuments(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+
+	seen := make(map[int]bool, len(docs))
+	seeds := make([]int, 0, len(docs))
+	for _, doc := range docs {
+		if id, ok := toInt(doc.Metadata[r.chunkKey]); ok {
+			seen[id] = true
+			seeds = append(seeds, id)
+		}
+	}
+
+	if len(seeds) == 0 {
+		return docs, nil
+	}
+
+	names, err := r.graph.EntitiesForChunks(ctx, seeds)
+	if err != nil {
+		return nil, fmt.Errorf("entitiesForChunks: %w", err)
+	}
+
+	graph, err := r.graph.Neighborhood(ctx, names, r.depth)
+	if err != nil {
+		return nil, fmt.Errorf("neighborhood: %w", err)
+	}
+
+	if len(graph.Relations) == 0 {
+		return docs, nil
+	}
+
+	lines := make([]string, len(graph.Relations))
+	for i, rel := range graph.Relations {
+		lines[i] = rel.String()
+	}
+
+	docs = append(docs, schema.Document{
+		PageContent: "Related concepts:\n" + strings.Join(lines, "\n"),
+		Metadata: map[string]any{
+			"graph":    true,
+			"entities": len(graph.Entities),
+		},
+	})
+
+	extra, err := r.connectedChunks(ctx, graph, seen)
+	if err != nil {
+		return nil, fmt.Errorf("connectedChunks: %w", err)
+	}
+
+	return append(docs, extra...), nil
+}
+
+// connectedChunks returns the chunks the neighborhood's relations were
+// extracted from, most connected first, skipping the seen chunks.
+func (r *GraphRetriever) connectedChunks(ctx context.Context, graph Graph, seen map[int]bool) ([]schema.Document, error) {
+	if r.maxChunks <= 0 {
+		return nil, nil
+	}
+
+	counts := make(map[int]int)
+	for _, rel := range graph.Relations {
+		for _, id := range rel.Chunks {
+			if !seen[id] {
+				counts[id]++
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if counts[ids[i]] != counts[ids[j]] {
+			return counts[ids[i]] > counts[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	if len(ids) > r.maxChunks {
+		ids = ids[:r.maxChunks]
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.D{{Key: r.chunkKey, Value: bson.D{{Key: "$in", Value: ids}}}}
+	projection := bson.D{{Key: r.chunkKey, Value: 1}, {Key: r.textKey, Value: 1}}
+
+	cur, err := r.chunks.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var results []bson.M
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("all: %w", err)
+	}
+
+	byID := make(map[int]schema.Document, len(results))
+	for _, res := range results {
+		id, _ := toInt(res[r.chunkKey])
+
+		doc := toDocument(res, r.textKey, "")
+		doc.Metadata["graph"] = true
+		byID[id] = doc
+	}
+
+	docs := make([]schema.Document, 0, len(ids))
+	for _, id := range ids {
+		if doc, exists := byID[id]; exists {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs, nil
+}
+
+// =============================================================================
+
+const extractPrompt = `Extract the Go programming concepts and the relationships between them from the text below.
+
+Respond with only a JSON document in this form:
+{"entities":[{"name":"escape analysis","type":"concept","description":"one sentence"}],"relations":[{"source":"escape analysis","target":"heap","type":"determines_allocation_on"}]}
+
+Use short lowercase names for the entities, such as "goroutine" or "escape analysis".
+Every relation must use entity names from the entities list.
+
+Text: %s`
+
+func normalizeEntity(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func relationID(r Relation) string {
+	return r.Source + "|" + r.Type + "|" + r.Target
+}
+
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,292 @@
+package mongodb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Bucket boundaries used by the collector's histograms.
+var (
+	durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	countBuckets    = []float64{0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 5000, 10000}
+	scoreBuckets    = []float64{.1, .2, .3, .4, .5, .6, .7, .75, .8, .85, .9, .95, 1}
+)
+
+// Collector is an in-memory implementation of Metrics. It keeps counters and
+// histograms for the samples it receives and can write them in the
+// Prometheus text format. It's safe for concurrent use.
+type Collector struct {
+	mu            sync.Mutex
+	commands      map[string]uint64
+	commandErrors map[string]uint64
+	latency       map[aggregateKey]*histogram
+	aggregateErrs map[aggregateKey]uint64
+	numCandidates map[string]*histogram
+	limits        map[string]*histogram
+	results       map[string]*histogram
+	emptyResults  map[string]uint64
+	scores        map[string]*histogram
+	poolEvents    map[string]uint64
+	checkedOut    int64
+	checkoutWaits *histogram
+}
+
+// NewCollector constructs a collector for use.
+func NewCollector() *Collector {
+	c := Collector{
+		commands:      make(map[string]uint64),
+		commandErrors: make(map[string]uint64),
+		latency:       make(map[aggregateKey]*histogram),
+		aggregateErrs: make(map[aggregateKey]uint64),
+		numCandidates: make(map[string]*histogram),
+		limits:        make(map[string]*histogram),
+		results:       make(map[string]*histogram),
+		emptyResults:  make(map[string]uint64),
+		scores:        make(map[string]*histogram),
+		poolEvents:    make(map[string]uint64),
+		checkoutWaits: newHistogram(durationBuckets),
+	}
+
+	return &c
+}
+
+// RecordCommand implements the Metrics interface.
+func (c *Collector) RecordCommand(sample CommandSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.commands[sample.Name]++
+
+	if sample.Err != nil {
+		c.commandErrors[sample.Name]++
+	}
+}
+
+// RecordAggregate implements the Metrics interface.
+func (c *Collector) RecordAggregate(sample AggregateSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := aggregateKey{
+		collection:   sample.Database + "." + sample.Collection,
+		vectorSearch: sample.VectorSearch,
+	}
+
+	observe(c.latency, key, durationBuckets, sample.Duration.Seconds())
+
+	if sample.Err != nil {
+		c.aggregateErrs[key]++
+		return
+	}
+
+	if !sample.VectorSearch {
+		return
+	}
+
+	observe(c.numCandidates, key.collection, countBuckets, float64(sample.NumCandidates))
+	observe(c.limits, key.collection, countBuckets, float64(sample.Limit))
+	observe(c.results, key.collection, countBuckets, float64(sample.Results))
+
+	if sample.Results == 0 {
+		c.emptyResults[key.collection]++
+	}
+
+	for _, score := range sample.Scores {
+		observe(c.scores, key.collection, scoreBuckets, score)
+	}
+}
+
+// RecordPool implements the Metrics interface.
+func (c *Collector) RecordPool(sample PoolSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.poolEvents[sample.Type]++
+
+	switch sample.Type {
+	case event.GetSucceeded:
+		c.checkedOut++
+		c.checkoutWaits.observe(sample.Duration.Seconds())
+
+	case event.ConnectionReturned:
+		c.checkedOut--
+	}
+}
+
+// WritePrometheus writes the collected metrics to w in the Prometheus text
+// exposition format.
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw, "mongodb_commands_total", "counter", "Commands sent to the server.")
+	for _, name := range sortedKeys(c.commands) {
+		fmt.Fprintf(bw, "mongodb_commands_total{command=%q} %d\n", name, c.commands[name])
+	}
+
+	writeHeader(bw, "mongodb_command_errors_total", "counter", "Commands that failed.")
+	for _, name := range sortedKeys(c.commandErrors) {
+		fmt.Fprintf(bw, "mongodb_command_errors_total{command=%q} %d\n", name, c.commandErrors[name])
+	}
+
+	writeHeader(bw, "mongodb_aggregate_duration_seconds", "histogram", "Latency of aggregate commands.")
+	for _, key := range sortedAggregateKeys(c.latency) {
+		c.latency[key].write(bw, "mongodb_aggregate_duration_seconds", key.labels())
+	}
+
+	writeHeader(bw, "mongodb_aggregate_errors_total", "counter", "Aggregate commands that failed.")
+	for _, key := range sortedAggregateKeys(c.aggregateErrs) {
+		fmt.Fprintf(bw, "mongodb_aggregate_errors_total{%s} %d\n", key.labels(), c.aggregateErrs[key])
+	}
+
+	writeHeader(bw, "mongodb_vector_search_num_candidates", "histogram", "numCandidates requested by $vectorSearch.")
+	writeHistograms(bw, "mongodb_vector_search_num_candidates", c.numCandidates)
+
+	writeHeader(bw, "mongodb_vector_search_limit", "histogram", "limit requested by $vectorSearch.")
+	writeHistograms(bw, "mongodb_vector_search_limit", c.limits)
+
+	writeHeader(bw, "mongodb_vector_search_results", "histogram", "Documents returned by $vectorSearch.")
+	writeHistograms(bw, "mongodb_vector_search_results", c.results)
+
+	writeHeader(bw, "mongodb_vector_search_empty_total", "counter", "$vectorSearch queries that returned no documents.")
+	for _, col := range sortedKeys(c.emptyResults) {
+		fmt.Fprintf(bw, "mongodb_vector_search_empty_total{collection=%q} %d\n", col, c.emptyResults[col])
+	}
+
+	writeHeader(bw, "mongodb_vector_search_score", "histogram", "Scores of documents returned by $vectorSearch.")
+	writeHistograms(bw, "mongodb_vector_search_score", c.scores)
+
+	writeHeader(bw, "mongodb_pool_events_total", "counter", "Connection pool events by type.")
+	for _, typ := range sortedKeys(c.poolEvents) {
+		fmt.Fprintf(bw, "mongodb_pool_events_total{type=%q} %d\n", typ, c.poolEvents[typ])
+	}
+
+	writeHeader(bw, "mongodb_pool_checked_out", "gauge", "Connections currently checked out of the pool.")
+	fmt.Fprintf(bw, "mongodb_pool_checked_out %d\n", c.checkedOut)
+
+	writeHeader(bw, "mongodb_pool_checkout_duration_seconds", "histogram", "Time spent waiting to check out a connection.")
+	c.checkoutWaits.write(bw, "mongodb_pool_checkout_duration_seconds", "")
+
+	return bw.Flush()
+}
+
+// ServeHTTP implements the http.Handler interface so the collector can be
+// mounted as a Prometheus scrape endpoint.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	if err := c.WritePrometheus(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// =============================================================================
+
+type aggregateKey struct {
+	collection   string
+	vectorSearch bool
+}
+
+func (k aggregateKey) labels() string {
+	return fmt.Sprintf("collection=%q,vector_search=%q", k.collection, strconv.FormatBool(k.vectorSearch))
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name string, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+
+	for i, le := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=%q} %d\n", name, labels, sep, strconv.FormatFloat(le, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func observe[K comparable](m map[K]*histogram, key K, buckets []float64, v float64) {
+	h, exists := m[key]
+	if !exists {
+		h = newHistogram(buckets)
+		m[key] = h
+	}
+
+	h.observe(v)
+}
+
+func writeHeader(w io.Writer, name string, typ string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func writeHistograms(w io.Writer, name string, m map[string]*histogram) {
+	for _, col := range sortedKeys(m) {
+		m[col].write(w, name, fmt.Sprintf("collection=%q", col))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedAggregateKeys[V any](m map[aggregateKey]V) []aggregateKey {
+	keys := make([]aggregateKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].collection != keys[j].collection {
+			return keys[i].collection < keys[j].collection
+		}
+		return !keys[i].vectorSearch && keys[j].vectorSearch
+	})
+
+	return keys
+}
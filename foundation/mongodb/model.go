@@ -1,9 +1,14 @@
 package mongodb
 
+import "go.mongodb.org/mongo-driver/bson"
+
 // Index represents information about an index.
 type Index struct {
-	ID   string `bson:"id"`
-	Type string `bson:"type"`
+	ID        string `bson:"id"`
+	Name      string `bson:"name"`
+	Type      string `bson:"type"`
+	Status    string `bson:"status"`
+	Queryable bool   `bson:"queryable"`
 }
 
 // VectorIndexSettings represents setting to create a vector index.
@@ -12,3 +17,74 @@ type VectorIndexSettings struct {
 	Path          string
 	Similarity    string
 }
+
+// VectorSearchSettings represents settings to perform a vector search.
+type VectorSearchSettings struct {
+	IndexName     string
+	Path          string
+	NumCandidates int
+	Limit         int
+	Exact         bool
+	Filter        bson.D
+
+	// ExcludePaths represents other embedding fields left out of the results
+	// along with the Path, like the shadow fields of other models, so the
+	// vectors aren't sent back with every document.
+	ExcludePaths []string
+}
+
+// SearchIndexSettings represents settings to create a full-text search index.
+type SearchIndexSettings struct {
+	// Analyzer represents the analyzer applied to string fields when
+	// indexing. An empty value uses lucene.standard.
+	Analyzer string
+
+	// SearchAnalyzer represents the analyzer applied to the query text. An
+	// empty value uses the index analyzer.
+	SearchAnalyzer string
+
+	// Dynamic represents if all fields in the document should be indexed
+	// automatically.
+	Dynamic bool
+
+	// Fields represents the explicit field mappings for the index.
+	Fields []SearchField
+}
+
+// SearchField represents a field mapping in a full-text search index.
+type SearchField struct {
+	Path           string
+	Type           string
+	Analyzer       string
+	SearchAnalyzer string
+}
+
+// TextSearchSettings represents settings to perform a full-text search.
+type TextSearchSettings struct {
+	IndexName string
+	Query     string
+	Paths     []string
+	Limit     int
+
+	// MaxEdits represents the number of single character edits allowed to
+	// match a term. Zero disables fuzzy matching.
+	MaxEdits int
+
+	// Highlight represents if the search should return highlighted passages
+	// for the matching terms.
+	Highlight bool
+}
+
+// Highlight represents a passage that matched a full-text search.
+type Highlight struct {
+	Path  string          `bson:"path"`
+	Texts []HighlightText `bson:"texts"`
+	Score float64         `bson:"score"`
+}
+
+// HighlightText represents a fragment of a highlighted passage. The type is
+// either hit for the matching term or text for the surrounding context.
+type HighlightText struct {
+	Value string `bson:"value"`
+	Type  string `bson:"type"`
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,16 +12,33 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-// Connect attempts to connect to a mongo db instance.
+// Connect attempts to connect to a mongo db instance. The client is
+// configured to store []float32 values as packed BSON binary vectors.
 func Connect(ctx context.Context, host string, userName string, password string) (*mongo.Client, error) {
-	auth := options.Client().SetAuth(options.Credential{
+	cfg := Config{
+		URI:      host,
 		Username: userName,
 		Password: password,
-	})
+	}
 
-	uri := options.Client().ApplyURI(host)
+	return ConnectWithConfig(ctx, cfg)
+}
 
-	client, err := mongo.Connect(ctx, auth, uri)
+// ConnectWithConfig attempts to connect to a mongo db instance using the
+// specified config. The client is configured to store []float32 values as
+// packed BSON binary vectors. Any extra options, such as MonitorOptions, are
+// applied on top of the config.
+func ConnectWithConfig(ctx context.Context, cfg Config, extra ...*options.ClientOptions) (*mongo.Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validate: %w", err)
+	}
+
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		return nil, fmt.Errorf("client options: %w", err)
+	}
+
+	client, err := mongo.Connect(ctx, append([]*options.ClientOptions{opts}, extra...)...)
 	if err != nil {
 		return nil, fmt.Errorf("connect: %w", err)
 	}
@@ -51,9 +69,9 @@ func CreateCollection(ctx context.Context, db *mongo.Database, collectionName st
 
 // CreateVectorIndex creates a very specific vector index for our example.
 func CreateVectorIndex(ctx context.Context, col *mongo.Collection, vectorIndexName string, settings VectorIndexSettings) error {
-	indexes, err := lookupVectorIndex(ctx, col, vectorIndexName)
+	indexes, err := lookupSearchIndex(ctx, col, vectorIndexName)
 	if err != nil {
-		return fmt.Errorf("lookupVectorIndex: %w", err)
+		return fmt.Errorf("lookupSearchIndex: %w", err)
 	}
 
 	if len(indexes) == 0 {
@@ -61,9 +79,9 @@ func CreateVectorIndex(ctx context.Context, col *mongo.Collection, vectorIndexNa
 			return fmt.Errorf("createVectorIndex: %w", err)
 		}
 
-		indexes, err = lookupVectorIndex(ctx, col, vectorIndexName)
+		indexes, err = lookupSearchIndex(ctx, col, vectorIndexName)
 		if err != nil {
-			return fmt.Errorf("lookupVectorIndex: %w", err)
+			return fmt.Errorf("lookupSearchIndex: %w", err)
 		}
 	}
 
@@ -74,11 +92,64 @@ func CreateVectorIndex(ctx context.Context, col *mongo.Collection, vectorIndexNa
 	return nil
 }
 
+// CreateSearchIndex creates a full-text search index and waits for the index
+// to become queryable.
+func CreateSearchIndex(ctx context.Context, col *mongo.Collection, searchIndexName string, settings SearchIndexSettings) error {
+	indexes, err := lookupSearchIndex(ctx, col, searchIndexName)
+	if err != nil {
+		return fmt.Errorf("lookupSearchIndex: %w", err)
+	}
+
+	if len(indexes) == 0 {
+		if err := runCreateSearchIndexCmd(ctx, col, searchIndexName, settings); err != nil {
+			return fmt.Errorf("createSearchIndex: %w", err)
+		}
+	}
+
+	if err := WaitForSearchIndex(ctx, col, searchIndexName); err != nil {
+		return fmt.Errorf("waitForSearchIndex: %w", err)
+	}
+
+	return nil
+}
+
+// WaitForSearchIndex blocks until the specified search or vector index is
+// queryable or the context is done.
+func WaitForSearchIndex(ctx context.Context, col *mongo.Collection, indexName string) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		indexes, err := lookupSearchIndex(ctx, col, indexName)
+		if err != nil {
+			return fmt.Errorf("lookupSearchIndex: %w", err)
+		}
+
+		if len(indexes) == 0 {
+			return fmt.Errorf("index %q does not exist", indexName)
+		}
+
+		if indexes[0].Queryable {
+			return nil
+		}
+
+		if indexes[0].Status == "FAILED" {
+			return fmt.Errorf("index %q failed to build", indexName)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 // =============================================================================
 
-func lookupVectorIndex(ctx context.Context, col *mongo.Collection, vectorIndexName string) ([]Index, error) {
+func lookupSearchIndex(ctx context.Context, col *mongo.Collection, indexName string) ([]Index, error) {
 	siv := col.SearchIndexes()
-	cur, err := siv.List(ctx, &options.SearchIndexesOptions{Name: &vectorIndexName})
+	cur, err := siv.List(ctx, &options.SearchIndexesOptions{Name: &indexName})
 	if err != nil {
 		return nil, fmt.Errorf("index: %w", err)
 	}
@@ -137,3 +208,78 @@ func runCreateIndexCmd(ctx context.Context, col *mongo.Collection, vectorIndexNa
 
 	return res.Err()
 }
+
+func runCreateSearchIndexCmd(ctx context.Context, col *mongo.Collection, searchIndexName string, settings SearchIndexSettings) error {
+	/*
+		db.runCommand(
+		{
+			createSearchIndexes: "book",
+			indexes: [{
+				name: "text_index",
+				type: "search",
+				definition: {
+					analyzer: "lucene.english",
+					mappings: {
+						dynamic: false,
+						fields: {
+							text: {
+								type: "string",
+								analyzer: "lucene.english"
+							}
+						}
+					}
+				}
+			}]
+		})
+	*/
+
+	fields := bson.D{}
+	for _, field := range settings.Fields {
+		typ := field.Type
+		if typ == "" {
+			typ = "string"
+		}
+
+		def := bson.D{{Key: "type", Value: typ}}
+
+		if field.Analyzer != "" {
+			def = append(def, bson.E{Key: "analyzer", Value: field.Analyzer})
+		}
+
+		if field.SearchAnalyzer != "" {
+			def = append(def, bson.E{Key: "searchAnalyzer", Value: field.SearchAnalyzer})
+		}
+
+		fields = append(fields, bson.E{Key: field.Path, Value: def})
+	}
+
+	definition := bson.D{}
+
+	if settings.Analyzer != "" {
+		definition = append(definition, bson.E{Key: "analyzer", Value: settings.Analyzer})
+	}
+
+	if settings.SearchAnalyzer != "" {
+		definition = append(definition, bson.E{Key: "searchAnalyzer", Value: settings.SearchAnalyzer})
+	}
+
+	definition = append(definition, bson.E{Key: "mappings", Value: bson.D{
+		{Key: "dynamic", Value: settings.Dynamic},
+		{Key: "fields", Value: fields},
+	}})
+
+	idx := bson.D{
+		{Key: "createSearchIndexes", Value: col.Name()},
+		{Key: "indexes", Value: []bson.D{
+			{
+				{Key: "name", Value: searchIndexName},
+				{Key: "type", Value: "search"},
+				{Key: "definition", Value: definition},
+			}},
+		},
+	}
+
+	res := col.Database().RunCommand(ctx, idx)
+
+	return res.Err()
+}
@@ -0,0 +1,209 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CommandSample represents the outcome of a single command sent to the
+// server.
+type CommandSample struct {
+	Name     string
+	Database string
+	Duration time.Duration
+	Err      error
+}
+
+// AggregateSample represents the outcome of a single aggregate command. For
+// a $vectorSearch, the numCandidates and limit from the stage are included.
+// Results and scores are taken from the first batch of the reply.
+type AggregateSample struct {
+	Database      string
+	Collection    string
+	VectorSearch  bool
+	NumCandidates int
+	Limit         int
+	Duration      time.Duration
+	Results       int
+	Scores        []float64
+	Err           error
+}
+
+// PoolSample represents a connection pool event.
+type PoolSample struct {
+	Type     string
+	Address  string
+	Duration time.Duration
+}
+
+// Metrics represents behavior for recording what the client is doing.
+type Metrics interface {
+	RecordCommand(sample CommandSample)
+	RecordAggregate(sample AggregateSample)
+	RecordPool(sample PoolSample)
+}
+
+// MonitorOptions returns client options that attach a command monitor and
+// a pool monitor reporting to the specified metrics. Pass the result to
+// ConnectWithConfig.
+func MonitorOptions(metrics Metrics) *options.ClientOptions {
+	m := monitor{
+		metrics: metrics,
+		pending: make(map[string]AggregateSample),
+	}
+
+	cmdMonitor := event.CommandMonitor{
+		Started:   m.started,
+		Succeeded: m.succeeded,
+		Failed:    m.failed,
+	}
+
+	poolMonitor := event.PoolMonitor{
+		Event: m.pool,
+	}
+
+	return options.Client().SetMonitor(&cmdMonitor).SetPoolMonitor(&poolMonitor)
+}
+
+// =============================================================================
+
+type monitor struct {
+	metrics Metrics
+
+	mu      sync.Mutex
+	pending map[string]AggregateSample
+}
+
+func (m *monitor) started(_ context.Context, evt *event.CommandStartedEvent) {
+	if evt.CommandName != "aggregate" {
+		return
+	}
+
+	sample := AggregateSample{
+		Database: evt.DatabaseName,
+	}
+
+	if col, ok := evt.Command.Lookup("aggregate").StringValueOK(); ok {
+		sample.Collection = col
+	}
+
+	if pipeline, ok := evt.Command.Lookup("pipeline").ArrayOK(); ok {
+		if stages, err := pipeline.Values(); err == nil && len(stages) > 0 {
+			if stage, ok := stages[0].DocumentOK(); ok {
+				if vs, ok := stage.Lookup("$vectorSearch").DocumentOK(); ok {
+					sample.VectorSearch = true
+					sample.NumCandidates = lookupInt(vs, "numCandidates")
+					sample.Limit = lookupInt(vs, "limit")
+				}
+			}
+		}
+	}
+
+	m.mu.Lock()
+	m.pending[requestKey(evt.ConnectionID, evt.RequestID)] = sample
+	m.mu.Unlock()
+}
+
+func (m *monitor) succeeded(_ context.Context, evt *event.CommandSucceededEvent) {
+	m.metrics.RecordCommand(CommandSample{
+		Name:     evt.CommandName,
+		Database: evt.DatabaseName,
+		Duration: evt.Duration,
+	})
+
+	sample, ok := m.take(evt.ConnectionID, evt.RequestID)
+	if !ok {
+		return
+	}
+
+	sample.Duration = evt.Duration
+
+	if batch, ok := evt.Reply.Lookup("cursor", "firstBatch").ArrayOK(); ok {
+		if docs, err := batch.Values(); err == nil {
+			sample.Results = len(docs)
+
+			for _, doc := range docs {
+				d, ok := doc.DocumentOK()
+				if !ok {
+					continue
+				}
+
+				if score, ok := d.Lookup("score").DoubleOK(); ok {
+					sample.Scores = append(sample.Scores, score)
+				}
+			}
+		}
+	}
+
+	m.metrics.RecordAggregate(sample)
+}
+
+func (m *monitor) failed(_ context.Context, evt *event.CommandFailedEvent) {
+	err := errors.New(evt.Failure)
+
+	m.metrics.RecordCommand(CommandSample{
+		Name:     evt.CommandName,
+		Database: evt.DatabaseName,
+		Duration: evt.Duration,
+		Err:      err,
+	})
+
+	sample, ok := m.take(evt.ConnectionID, evt.RequestID)
+	if !ok {
+		return
+	}
+
+	sample.Duration = evt.Duration
+	sample.Err = err
+
+	m.metrics.RecordAggregate(sample)
+}
+
+func (m *monitor) pool(evt *event.PoolEvent) {
+	m.metrics.RecordPool(PoolSample{
+		Type:     evt.Type,
+		Address:  evt.Address,
+		Duration: evt.Duration,
+	})
+}
+
+func (m *monitor) take(connectionID string, requestID int64) (AggregateSample, bool) {
+	key := requestKey(connectionID, requestID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sample, ok := m.pending[key]
+	if ok {
+		delete(m.pending, key)
+	}
+
+	return sample, ok
+}
+
+func requestKey(connectionID string, requestID int64) string {
+	return fmt.Sprintf("%s/%d", connectionID, requestID)
+}
+
+func lookupInt(doc bson.Raw, key string) int {
+	v := doc.Lookup(key)
+
+	switch v.Type {
+	case bsontype.Int32:
+		return int(v.Int32())
+	case bsontype.Int64:
+		return int(v.Int64())
+	case bsontype.Double:
+		return int(v.Double())
+	}
+
+	return 0
+}
@@ -0,0 +1,489 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Section represents a parent section of a document, such as a chapter
+// section of a book. Sections are split into small chunks for searching.
+type Section struct {
+	ID    int    `bson:"id" json:"ID"`
+	Title string `bson:"title" json:"Title"`
+	Text  string `bson:"text" json:"Text"`
+}
+
+// Chunk represents a small piece of a section that is embedded and searched.
+// Seq is the position of the chunk within its section, starting at zero.
+type Chunk struct {
+	ID        int       `bson:"id" json:"ID"`
+	SectionID int       `bson:"section_id" json:"SectionID"`
+	Seq       int       `bson:"seq" json:"Seq"`
+	Text      string    `bson:"text" json:"Text"`
+	Embedding []float32 `bson:"embedding,omitempty" json:"Embedding,omitempty"`
+
+	// Model represents the model that produced the embedding, so a migration
+	// to another model can find the chunks to re-embed.
+	Model *EmbeddingModel `bson:"embedding_model,omitempty" json:"Model,omitempty"`
+}
+
+// ExpandMode represents how the chunks matched by a search are expanded
+// into the content returned to the caller.
+type ExpandMode int
+
+// Set of expand modes.
+const (
+	// ExpandSection returns the parent section of the matched chunks.
+	ExpandSection ExpandMode = iota
+
+	// ExpandWindow returns the matched chunks together with the neighboring
+	// chunks from the same section.
+	ExpandWindow
+)
+
+// ParentRetrieverConfig represents the settings required to construct a
+// parent retriever.
+type ParentRetrieverConfig struct {
+	Chunks   *mongo.Collection
+	Sections *mongo.Collection
+	Embedder Embedder
+	Search   VectorSearchSettings
+	Mode     ExpandMode
+
+	// Window represents the number of chunks on each side of a matched
+	// chunk to include with ExpandWindow.
+	// Ex: 2
+	Window int
+
+	// TokenBudget represents the maximum number of tokens returned across
+	// all documents. Expanded content that doesn't fit is replaced by the
+	// matched chunks alone. Zero means no budget.
+	// Ex: 2000
+	TokenBudget int
+
+	// CountTokens returns the number of tokens in the text. The default
+	// counts words.
+	CountTokens func(text string) int
+
+	// ScoreThreshold represents the minimum score a chunk must have to be
+	// expanded.
+	// Ex: 0.70
+	ScoreThreshold float64
+}
+
+// ParentRetriever implements the langchaingo schema.Retriever interface. It
+// searches the small chunks for a precise match and returns the larger
+// context the chunks came from.
+type ParentRetriever struct {
+	chunks         *mongo.Collection
+	sections       *mongo.Collection
+	embedder       Embedder
+	search         VectorSearchSettings
+	mode           ExpandMode
+	window         int
+	tokenBudget    int
+	countTokens    func(text string) int
+	scoreThreshold float64
+}
+
+var _ schema.Retriever = (*ParentRetriever)(nil)
+
+// NewParentRetriever constructs a parent retriever for use.
+func NewParentRetriever(cfg ParentRetrieverConfig) (*ParentRetriever, error) {
+	if cfg.Chunks == nil || cfg.Embedder == nil {
+		return nil, errors.New("chunks collection and embedder are required")
+	}
+
+	switch cfg.Mode {
+	case ExpandSection:
+		if cfg.Sections == nil {
+			return nil, errors.New("sections collection is required to expand sections")
+		}
+
+	case ExpandWindow:
+		if cfg.Window < 0 {
+			return nil, errors.New("window can't be negative")
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown expand mode %d", cfg.Mode)
+	}
+
+	if cfg.Search.IndexName == "" || cfg.Search.Path == "" {
+		return nil, errors.New("search index name and path are required")
+	}
+
+	if cfg.Search.Limit <= 0 {
+		return nil, errors.New("search limit must be greater than zero")
+	}
+
+	countTokens := cfg.CountTokens
+	if countTokens == nil {
+		countTokens = func(text string) int {
+			return len(strings.Fields(text))
+		}
+	}
+
+	r := ParentRetriever{
+		chunks:         cfg.Chunks,
+		sections:       cfg.Sections,
+		embedder:       cfg.Embedder,
+		search:         cfg.Search,
+		mode:           cfg.Mode,
+		window:         cfg.Window,
+		tokenBudget:    cfg.TokenBudget,
+		countTokens:    countTokens,
+		scoreThreshold: cfg.ScoreThreshold,
+	}
+
+	return &r, nil
+}
+
+// GetRelevantDocuments searches the chunks for the query and returns one
+// document per section or window, ordered by the best matching chunk. The
+// metadata holds the section_id and the ids of the matched chunks. Expanded
+// sections and windows also have an _id that SourceText accepts.
+func (r *ParentRetriever) GetRelevantDocuments(ctx context.Context, query string) ([]schema.Document, error) {
+	embedding, err := r.embedder.CreateEmbedding(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("create embedding: %w", err)
+	}
+
+	if len(embedding) == 0 {
+		return nil, errors.New("no embedding returned")
+	}
+
+	var hits []chunkHit
+	if err := VectorSearch(ctx, r.chunks, r.search, embedding[0], &hits); err != nil {
+		return nil, fmt.Errorf("vectorSearch: %w", err)
+	}
+
+	var groups []*chunkGroup
+
+	switch r.mode {
+	case ExpandSection:
+		groups, err = r.expandSections(ctx, r.group(hits, -1))
+	case ExpandWindow:
+		groups, err = r.expandWindows(ctx, r.group(hits, r.window))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.fit(groups), nil
+}
+
+// SourceText returns the current text of the expanded sections or windows
+// with the specified ids, as found in the _id of their metadata. Ids that no
+// longer resolve are left out. It's used by the answer cache to detect
+// answers whose sources have changed.
+func (r *ParentRetriever) SourceText(ctx context.Context, ids []any) (map[any]string, error) {
+	texts := make(map[any]string, len(ids))
+
+	if r.mode == ExpandWindow {
+		for _, id := range ids {
+			sectionID, from, to, ok := parseWindowID(id)
+			if !ok {
+				continue
+			}
+
+			text, err := r.windowText(ctx, sectionID, from, to)
+			if err != nil {
+				return nil, err
+			}
+
+			if text != "" {
+				texts[id] = text
+			}
+		}
+
+		return texts, nil
+	}
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+
+	cur, err := r.sections.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("find sections: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var sections []sectionDoc
+	if err := cur.All(ctx, &sections); err != nil {
+		return nil, fmt.Errorf("all sections: %w", err)
+	}
+
+	for _, s := range sections {
+		texts[s.DocID] = s.Text
+	}
+
+	return texts, nil
+}
+
+// =============================================================================
+
+// chunkHit represents a chunk returned by the vector search.
+type chunkHit struct {
+	Chunk `bson:",inline"`
+	Score float64 `bson:"score"`
+}
+
+// chunkGroup represents the matched chunks that expand into the same
+// content. With a window, a section can have several groups when the
+// matched chunks are too far apart for their windows to overlap.
+type chunkGroup struct {
+	sectionID int
+	from      int
+	to        int
+	score     float64
+	hits      []Chunk
+	docID     any
+	title     string
+	text      string
+}
+
+// group collects the hits above the score threshold into groups, merging
+// hits from the same section whose windows overlap or touch. A negative
+// window merges every hit from the same section. Groups keep the order of
+// their best hit.
+func (r *ParentRetriever) group(hits []chunkHit, window int) []*chunkGroup {
+	var groups []*chunkGroup
+
+	for _, hit := range hits {
+		if hit.Score < r.scoreThreshold {
+			continue
+		}
+
+		from := max(hit.Seq-max(window, 0), 0)
+		to := hit.Seq + max(window, 0)
+
+		var merged bool
+		for _, g := range groups {
+			if g.sectionID != hit.SectionID {
+				continue
+			}
+
+			if window >= 0 && (from > g.to+1 || to < g.from-1) {
+				continue
+			}
+
+			g.from = min(g.from, from)
+			g.to = max(g.to, to)
+			g.hits = append(g.hits, hit.Chunk)
+			merged = true
+			break
+		}
+
+		if merged {
+			continue
+		}
+
+		groups = append(groups, &chunkGroup{
+			sectionID: hit.SectionID,
+			from:      from,
+			to:        to,
+			score:     hit.Score,
+			hits:      []Chunk{hit.Chunk},
+		})
+	}
+
+	return groups
+}
+
+// expandSections fetches the parent section for every group in one query.
+func (r *ParentRetriever) expandSections(ctx context.Context, groups []*chunkGroup) ([]*chunkGroup, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int, len(groups))
+	for i, g := range groups {
+		ids[i] = g.sectionID
+	}
+
+	filter := bson.D{{Key: "id", Value: bson.D{{Key: "$in", Value: ids}}}}
+
+	cur, err := r.sections.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("find sections: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var sections []sectionDoc
+	if err := cur.All(ctx, &sections); err != nil {
+		return nil, fmt.Errorf("all sections: %w", err)
+	}
+
+	byID := make(map[int]sectionDoc, len(sections))
+	for _, s := range sections {
+		byID[s.ID] = s
+	}
+
+	for _, g := range groups {
+		s, exists := byID[g.sectionID]
+		if !exists {
+			continue
+		}
+
+		g.docID = s.DocID
+		g.title = s.Title
+		g.text = s.Text
+	}
+
+	return groups, nil
+}
+
+// expandWindows fetches the chunks that make up the window for every group.
+func (r *ParentRetriever) expandWindows(ctx context.Context, groups []*chunkGroup) ([]*chunkGroup, error) {
+	for _, g := range groups {
+		text, err := r.windowText(ctx, g.sectionID, g.from, g.to)
+		if err != nil {
+			return nil, err
+		}
+
+		g.docID = windowID(g.sectionID, g.from, g.to)
+		g.text = text
+	}
+
+	return groups, nil
+}
+
+// windowText joins the chunks of the section between the two positions.
+func (r *ParentRetriever) windowText(ctx context.Context, sectionID int, from int, to int) (string, error) {
+	filter := bson.D{
+		{Key: "section_id", Value: sectionID},
+		{Key: "seq", Value: bson.D{
+			{Key: "$gte", Value: from},
+			{Key: "$lte", Value: to},
+		}},
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "seq", Value: 1}}).
+		SetProjection(bson.D{{Key: "text", Value: 1}})
+
+	cur, err := r.chunks.Find(ctx, filter, opts)
+	if err != nil {
+		return "", fmt.Errorf("find chunks: %w", err)
+	}
+
+	var chunks []Chunk
+	if err := cur.All(ctx, &chunks); err != nil {
+		return "", fmt.Errorf("all chunks: %w", err)
+	}
+
+	return joinChunks(chunks), nil
+}
+
+// fit converts the groups into documents that fit in the token budget.
+// When the expanded content doesn't fit, the matched chunks are used on
+// their own, and when those don't fit either the group is dropped.
+func (r *ParentRetriever) fit(groups []*chunkGroup) []schema.Document {
+	docs := make([]schema.Document, 0, len(groups))
+	remaining := r.tokenBudget
+
+	for _, g := range groups {
+		sort.Slice(g.hits, func(i, j int) bool {
+			return g.hits[i].Seq < g.hits[j].Seq
+		})
+
+		text := g.text
+		expanded := text != ""
+		if !expanded {
+			text = joinChunks(g.hits)
+		}
+
+		if r.tokenBudget > 0 {
+			tokens := r.countTokens(text)
+
+			if tokens > remaining && expanded {
+				text = joinChunks(g.hits)
+				tokens = r.countTokens(text)
+				expanded = false
+			}
+
+			if tokens > remaining {
+				continue
+			}
+
+			remaining -= tokens
+		}
+
+		chunkIDs := make([]int, len(g.hits))
+		for i, c := range g.hits {
+			chunkIDs[i] = c.ID
+		}
+
+		metadata := map[string]any{
+			"section_id": g.sectionID,
+			"chunk_ids":  chunkIDs,
+			"expanded":   expanded,
+		}
+
+		if expanded {
+			metadata["_id"] = g.docID
+		}
+
+		if r.mode == ExpandSection && expanded {
+			metadata["title"] = g.title
+		}
+
+		if r.mode == ExpandWindow && expanded {
+			metadata["seq_from"] = g.from
+			metadata["seq_to"] = g.to
+		}
+
+		docs = append(docs, schema.Document{
+			PageContent: text,
+			Score:       float32(g.score),
+			Metadata:    metadata,
+		})
+	}
+
+	return docs
+}
+
+// sectionDoc represents a section as it's stored, with its _id so the
+// section can be referenced as the source of an answer.
+type sectionDoc struct {
+	DocID   any `bson:"_id"`
+	Section `bson:",inline"`
+}
+
+// windowID returns the stable id of the window over the section between the
+// two positions.
+// Ex: 12:3-7
+func windowID(sectionID int, from int, to int) string {
+	return fmt.Sprintf("%d:%d-%d", sectionID, from, to)
+}
+
+func parseWindowID(id any) (sectionID int, from int, to int, ok bool) {
+	s, isString := id.(string)
+	if !isString {
+		return 0, 0, 0, false
+	}
+
+	if _, err := fmt.Sscanf(s, "%d:%d-%d", &sectionID, &from, &to); err != nil {
+		return 0, 0, 0, false
+	}
+
+	return sectionID, from, to, windowID(sectionID, from, to) == s
+}
+
+func joinChunks(chunks []Chunk) string {
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Text
+	}
+
+	return strings.Join(texts, " ")
+}
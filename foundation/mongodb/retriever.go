@@ -0,0 +1,266 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Embedder represents behavior for producing vector embeddings. The ollama
+// LLM value implements this interface.
+type Embedder interface {
+	CreateEmbedding(ctx context.Context, inputTexts []string) ([][]float32, error)
+}
+
+// RetrieverConfig represents the settings required to construct a retriever.
+type RetrieverConfig struct {
+	Collection *mongo.Collection
+	Embedder   Embedder
+	Search     VectorSearchSettings
+
+	// TextKey represents the document field that holds the page content.
+	// Ex: text
+	TextKey string
+
+	// ScoreThreshold represents the minimum score a document must have to
+	// be returned.
+	// Ex: 0.70
+	ScoreThreshold float64
+
+	// Registry represents the optional collection holding the active
+	// embedding for the collection. When set, the search path, index and
+	// model follow the active embedding, so readers switch over as soon as
+	// a migration completes. Until the collection has an active embedding,
+	// the Embedder and Search settings are used.
+	Registry *mongo.Collection
+
+	// EmbedderFor returns the embedder for the specified model. It's required
+	// when a registry is set.
+	EmbedderFor func(model EmbeddingModel) (Embedder, error)
+}
+
+// Retriever implements the langchaingo schema.Retriever interface over a
+// MongoDB vector index.
+type Retriever struct {
+	col            *mongo.Collection
+	embedder       Embedder
+	search         VectorSearchSettings
+	textKey        string
+	scoreThreshold float64
+	registry       *mongo.Collection
+	embedderFor    func(model EmbeddingModel) (Embedder, error)
+
+	mu        sync.Mutex
+	embedders map[EmbeddingModel]Embedder
+}
+
+var _ schema.Retriever = (*Retriever)(nil)
+
+// NewRetriever constructs a retriever for use.
+func NewRetriever(cfg RetrieverConfig) (*Retriever, error) {
+	if cfg.Collection == nil {
+		return nil, errors.New("collection is required")
+	}
+
+	if cfg.Embedder == nil {
+		return nil, errors.New("embedder is required")
+	}
+
+	if cfg.Search.IndexName == "" || cfg.Search.Path == "" {
+		return nil, errors.New("search index name and path are required")
+	}
+
+	if cfg.Registry != nil && cfg.EmbedderFor == nil {
+		return nil, errors.New("embedderFor is required with a registry")
+	}
+
+	if cfg.Search.Limit <= 0 {
+		return nil, errors.New("search limit must be greater than zero")
+	}
+
+	textKey := cfg.TextKey
+	if textKey == "" {
+		textKey = "text"
+	}
+
+	r := Retriever{
+		col:            cfg.Collection,
+		embedder:       cfg.Embedder,
+		search:         cfg.Search,
+		textKey:        textKey,
+		scoreThreshold: cfg.ScoreThreshold,
+		registry:       cfg.Registry,
+		embedderFor:    cfg.EmbedderFor,
+		embedders:      make(map[EmbeddingModel]Embedder),
+	}
+
+	return &r, nil
+}
+
+// GetRelevantDocuments embeds the query and performs a vector search,
+// returning the documents that meet the score threshold.
+func (r *Retriever) GetRelevantDocuments(ctx context.Context, query string) ([]schema.Document, error) {
+	embedder, search, err := r.resolve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+
+	embedding, err := embedder.CreateEmbedding(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("create embedding: %w", err)
+	}
+
+	if len(embedding) == 0 {
+		return nil, errors.New("no embedding returned")
+	}
+
+	var results []bson.M
+	if err := VectorSearch(ctx, r.col, search, embedding[0], &results); err != nil {
+		return nil, fmt.Errorf("vectorSearch: %w", err)
+	}
+
+	docs := make([]schema.Document, 0, len(results))
+	for _, res := range results {
+		doc := toDocument(res, r.textKey, search.Path)
+		if float64(doc.Score) < r.scoreThreshold {
+			continue
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// =============================================================================
+
+// resolve returns the embedder and search settings to use for a query. With
+// a registry, these come from the active embedding for the collection once
+// one is set.
+func (r *Retriever) resolve(ctx context.Context) (Embedder, VectorSearchSettings, error) {
+	if r.registry == nil {
+		return r.embedder, r.search, nil
+	}
+
+	entry, err := lookupEmbeddings(ctx, r.registry, r.col.Name())
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return r.embedder, r.search, nil
+	case err != nil:
+		return nil, VectorSearchSettings{}, fmt.Errorf("lookupEmbeddings: %w", err)
+	}
+
+	search := r.search
+	search.ExcludePaths = append(slices.Clone(r.search.ExcludePaths), entry.Paths...)
+
+	// The first migration records its shadow field before any embedding is
+	// active.
+	target := entry.Active
+	if target.Path == "" {
+		return r.embedder, search, nil
+	}
+
+	search.IndexName = target.IndexName
+	search.Path = target.Path
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	embedder, exists := r.embedders[target.Model]
+	if !exists {
+		embedder, err = r.embedderFor(target.Model)
+		if err != nil {
+			return nil, VectorSearchSettings{}, fmt.Errorf("embedderFor: %w", err)
+		}
+
+		r.embedders[target.Model] = embedder
+	}
+
+	return embedder, search, nil
+}
+
+// toDocument maps a search result into a langchaingo document. The text and
+// score fields are lifted out, the embeddings are dropped, and every other
+// field, including the _id, is returned as metadata.
+func toDocument(res bson.M, textKey string, embeddingKey string) schema.Document {
+	var doc schema.Document
+
+	if text, ok := res[textKey].(string); ok {
+		doc.PageContent = text
+	}
+
+	if score, ok := res["score"].(float64); ok {
+		doc.Score = float32(score)
+	}
+
+	metadata := withoutEmbeddings(res, embeddingKey)
+	delete(metadata, textKey)
+	delete(metadata, "score")
+
+	doc.Metadata = metadata
+
+	return doc
+}
+
+// embeddingSuffixes represents the suffixes of the fields stored next to an
+// embedding: the model tag, the content hash and the failure marker.
+var embeddingSuffixes = []string{"_model", "_hash", "_error"}
+
+// withoutEmbeddings returns a copy of the document without the specified
+// embedding or any other embedding, such as the shadow field of an inactive
+// target. Other embeddings are found by their model tag.
+func withoutEmbeddings(doc bson.M, embeddingKey string) bson.M {
+	embeddings := make(map[string]bool)
+	if embeddingKey != "" {
+		embeddings[embeddingKey] = true
+	}
+
+	for k, v := range doc {
+		path, ok := strings.CutSuffix(k, "_model")
+		if !ok {
+			continue
+		}
+
+		if tag, ok := v.(bson.M); ok && tag["name"] != nil && tag["dimensions"] != nil {
+			embeddings[path] = true
+		}
+	}
+
+	out := make(bson.M, len(doc))
+
+	for k, v := range doc {
+		if isEmbeddingField(k, embeddings) {
+			continue
+		}
+
+		// The path of a shadow field can point into a sub-document.
+		if sub, ok := v.(bson.M); ok {
+			v = withoutEmbeddings(sub, "")
+		}
+
+		out[k] = v
+	}
+
+	return out
+}
+
+func isEmbeddingField(key string, embeddings map[string]bool) bool {
+	if embeddings[key] {
+		return true
+	}
+
+	for _, suffix := range embeddingSuffixes {
+		if path, ok := strings.CutSuffix(key, suffix); ok && embeddings[path] {
+			return true
+		}
+	}
+
+	return false
+}
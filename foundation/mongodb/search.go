@@ -0,0 +1,182 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// VectorSearch performs a $vectorSearch aggregation against the specified
+// collection and decodes the matching documents into results. Each document
+// will have a score field containing the vectorSearchScore.
+func VectorSearch(ctx context.Context, col *mongo.Collection, settings VectorSearchSettings, embedding []float32, results any) error {
+	if len(embedding) == 0 {
+		return errors.New("empty embedding")
+	}
+
+	cur, err := col.Aggregate(ctx, vectorSearchPipeline(settings, embedding))
+	if err != nil {
+		return fmt.Errorf("aggregate: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	if err := cur.All(ctx, results); err != nil {
+		return fmt.Errorf("all: %w", err)
+	}
+
+	return nil
+}
+
+// TextSearch performs a $search aggregation against the specified collection
+// and decodes the matching documents into results. Each document will have a
+// score field containing the searchScore and, when highlighting is enabled, a
+// highlights field that can be decoded into a slice of Highlight.
+func TextSearch(ctx context.Context, col *mongo.Collection, settings TextSearchSettings, results any) error {
+	if settings.Query == "" {
+		return errors.New("empty query")
+	}
+
+	if len(settings.Paths) == 0 {
+		return errors.New("no paths to search")
+	}
+
+	cur, err := col.Aggregate(ctx, textSearchPipeline(settings))
+	if err != nil {
+		return fmt.Errorf("aggregate: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	if err := cur.All(ctx, results); err != nil {
+		return fmt.Errorf("all: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+func vectorSearchPipeline(settings VectorSearchSettings, embedding []float32) mongo.Pipeline {
+	/*
+		db.book.aggregate([
+		{
+			$vectorSearch: {
+				index: "vector_index",
+				exact: false,
+				path: "embedding",
+				queryVector: [...],
+				numCandidates: 10,
+				limit: 5
+			}
+		},
+		{
+			$project: {
+				embedding: 0
+			}
+		},
+		{
+			$addFields: {
+				score: { $meta: "vectorSearchScore" }
+			}
+		}])
+	*/
+
+	numCandidates := settings.NumCandidates
+	if numCandidates < settings.Limit {
+		numCandidates = settings.Limit
+	}
+
+	vs := bson.D{
+		{Key: "index", Value: settings.IndexName},
+		{Key: "exact", Value: settings.Exact},
+		{Key: "path", Value: settings.Path},
+		{Key: "queryVector", Value: embedding},
+		{Key: "limit", Value: settings.Limit},
+	}
+
+	// Exact (ENN) searches don't accept numCandidates.
+	if !settings.Exact {
+		vs = append(vs, bson.E{Key: "numCandidates", Value: numCandidates})
+	}
+
+	if len(settings.Filter) > 0 {
+		vs = append(vs, bson.E{Key: "filter", Value: settings.Filter})
+	}
+
+	project := bson.D{{Key: settings.Path, Value: 0}}
+	for _, path := range settings.ExcludePaths {
+		if path == "" || slices.ContainsFunc(project, func(e bson.E) bool { return e.Key == path }) {
+			continue
+		}
+
+		project = append(project, bson.E{Key: path, Value: 0})
+	}
+
+	return mongo.Pipeline{
+		{{Key: "$vectorSearch", Value: vs}},
+		{{Key: "$project", Value: project}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "score", Value: bson.D{{Key: "$meta", Value: "vectorSearchScore"}}},
+		}}},
+	}
+}
+
+func textSearchPipeline(settings TextSearchSettings) mongo.Pipeline {
+	/*
+		db.book.aggregate([
+		{
+			$search: {
+				index: "text_index",
+				text: {
+					query: "escape analysis",
+					path: ["text"],
+					fuzzy: { maxEdits: 1 }
+				},
+				highlight: { path: ["text"] }
+			}
+		},
+		{ $limit: 5 },
+		{
+			$addFields: {
+				score: { $meta: "searchScore" },
+				highlights: { $meta: "searchHighlights" }
+			}
+		}])
+	*/
+
+	text := bson.D{
+		{Key: "query", Value: settings.Query},
+		{Key: "path", Value: settings.Paths},
+	}
+
+	if settings.MaxEdits > 0 {
+		text = append(text, bson.E{Key: "fuzzy", Value: bson.D{{Key: "maxEdits", Value: settings.MaxEdits}}})
+	}
+
+	search := bson.D{
+		{Key: "index", Value: settings.IndexName},
+		{Key: "text", Value: text},
+	}
+
+	addFields := bson.D{
+		{Key: "score", Value: bson.D{{Key: "$meta", Value: "searchScore"}}},
+	}
+
+	if settings.Highlight {
+		search = append(search, bson.E{Key: "highlight", Value: bson.D{{Key: "path", Value: settings.Paths}}})
+		addFields = append(addFields, bson.E{Key: "highlights", Value: bson.D{{Key: "$meta", Value: "searchHighlights"}}})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$search", Value: search}},
+	}
+
+	if settings.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: settings.Limit}})
+	}
+
+	return append(pipeline, bson.D{{Key: "$addFields", Value: addFields}})
+}
@@ -0,0 +1,50 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVectorSearchProjection(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings VectorSearchSettings
+		exp      bson.D
+	}{
+		{
+			name:     "path",
+			settings: VectorSearchSettings{Path: "embedding", Limit: 1},
+			exp:      bson.D{{Key: "embedding", Value: 0}},
+		},
+		{
+			name: "shadow paths",
+			settings: VectorSearchSettings{
+				Path:         "embedding",
+				Limit:        1,
+				ExcludePaths: []string{"embeddings.v2", "", "embedding", "embeddings.v2"},
+			},
+			exp: bson.D{{Key: "embedding", Value: 0}, {Key: "embeddings.v2", Value: 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline := vectorSearchPipeline(tt.settings, []float32{1})
+
+			var project bson.D
+			for _, stage := range pipeline {
+				if stage[0].Key == "$project" {
+					project = stage[0].Value.(bson.D)
+				}
+			}
+
+			got, _ := bson.MarshalExtJSON(project, false, false)
+			exp, _ := bson.MarshalExtJSON(tt.exp, false, false)
+
+			if string(got) != string(exp) {
+				t.Fatalf("project: got %s, exp %s", got, exp)
+			}
+		})
+	}
+}
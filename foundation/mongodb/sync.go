@@ -0,0 +1,220 @@
+package mongodb
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmbeddingRecord represents a single chunk and its embedding as it's stored
+// in both an embeddings JSONL file and the collection.
+type EmbeddingRecord struct {
+	ID        int            `bson:"id" json:"ID"`
+	Text      string         `bson:"text" json:"Text"`
+	Embedding []float32      `bson:"embedding" json:"Embedding"`
+	Model     EmbeddingModel `bson:"embedding_model" json:"Model"`
+}
+
+// Hash returns a hash of the content of the record. Two records with the
+// same hash have the same text embedded by the same model.
+func (r EmbeddingRecord) Hash() string {
+	h := sha256.New()
+	h.Write([]byte(r.Text))
+	h.Write([]byte{0})
+	h.Write([]byte(r.Model.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(r.Model.Dimensions)))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(r.Model.Version)))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SyncPlan represents the changes required to make a collection match an
+// embeddings file.
+type SyncPlan struct {
+	Inserts   []EmbeddingRecord
+	Updates   []EmbeddingRecord
+	Deletes   []int
+	Unchanged int
+}
+
+// Empty reports whether the plan has no changes to apply.
+func (p SyncPlan) Empty() bool {
+	return len(p.Inserts) == 0 && len(p.Updates) == 0 && len(p.Deletes) == 0
+}
+
+// String returns a report of the plan suitable for a dry run.
+func (p SyncPlan) String() string {
+	return fmt.Sprintf("inserts[%d] updates[%d] deletes[%d] unchanged[%d]", len(p.Inserts), len(p.Updates), len(p.Deletes), p.Unchanged)
+}
+
+// ReadEmbeddings reads the records from an embeddings JSONL stream, one
+// record per line.
+func ReadEmbeddings(r io.Reader) ([]EmbeddingRecord, error) {
+	var records []EmbeddingRecord
+	seen := make(map[int]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var line int
+	for scanner.Scan() {
+		line++
+
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec EmbeddingRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: unmarshal: %w", line, err)
+		}
+
+		if seen[rec.ID] {
+			return nil, fmt.Errorf("line %d: duplicate id %d", line, rec.ID)
+		}
+		seen[rec.ID] = true
+
+		records = append(records, rec)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	return records, nil
+}
+
+// PlanSync diffs the records against the collection by id and content hash
+// and returns the inserts, updates and deletes required to make the
+// collection match the records.
+func PlanSync(ctx context.Context, col *mongo.Collection, records []EmbeddingRecord) (SyncPlan, error) {
+	projection := bson.D{
+		{Key: "id", Value: 1},
+		{Key: "text", Value: 1},
+		{Key: "embedding_model", Value: 1},
+	}
+
+	cur, err := col.Find(ctx, bson.D{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return SyncPlan{}, fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	existing := make(map[int]string)
+	for cur.Next(ctx) {
+		var rec EmbeddingRecord
+		if err := cur.Decode(&rec); err != nil {
+			return SyncPlan{}, fmt.Errorf("decode: %w", err)
+		}
+
+		existing[rec.ID] = rec.Hash()
+	}
+
+	if err := cur.Err(); err != nil {
+		return SyncPlan{}, fmt.Errorf("cursor: %w", err)
+	}
+
+	var plan SyncPlan
+
+	for _, rec := range records {
+		hash, exists := existing[rec.ID]
+		switch {
+		case !exists:
+			plan.Inserts = append(plan.Inserts, rec)
+		case hash != rec.Hash():
+			plan.Updates = append(plan.Updates, rec)
+		default:
+			plan.Unchanged++
+		}
+
+		delete(existing, rec.ID)
+	}
+
+	// Whatever is left in the collection is not in the file.
+	for id := range existing {
+		plan.Deletes = append(plan.Deletes, id)
+	}
+
+	sort.Ints(plan.Deletes)
+
+	return plan, nil
+}
+
+// ApplySync applies the plan to the collection in a single unordered bulk
+// write.
+func ApplySync(ctx context.Context, col *mongo.Collection, plan SyncPlan) error {
+	if plan.Empty() {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(plan.Inserts)+len(plan.Updates)+len(plan.Deletes))
+
+	for _, rec := range plan.Inserts {
+		models = append(models, mongo.NewInsertOneModel().SetDocument(rec))
+	}
+
+	for _, rec := range plan.Updates {
+		update := bson.D{{Key: "$set", Value: rec}}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "id", Value: rec.ID}}).SetUpdate(update))
+	}
+
+	for _, id := range plan.Deletes {
+		models = append(models, mongo.NewDeleteOneModel().SetFilter(bson.D{{Key: "id", Value: id}}))
+	}
+
+	if _, err := col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("bulk write: %w", err)
+	}
+
+	return nil
+}
+
+// ExportEmbeddings writes every document in the collection to w as an
+// embeddings JSONL stream ordered by id. It returns the number of records
+// written.
+func ExportEmbeddings(ctx context.Context, col *mongo.Collection, w io.Writer) (int, error) {
+	cur, err := col.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "id", Value: 1}}))
+	if err != nil {
+		return 0, fmt.Errorf("find: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	var count int
+	for cur.Next(ctx) {
+		var rec EmbeddingRecord
+		if err := cur.Decode(&rec); err != nil {
+			return count, fmt.Errorf("decode: %w", err)
+		}
+
+		if err := enc.Encode(rec); err != nil {
+			return count, fmt.Errorf("encode: %w", err)
+		}
+
+		count++
+	}
+
+	if err := cur.Err(); err != nil {
+		return count, fmt.Errorf("cursor: %w", err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return count, fmt.Errorf("flush: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,170 @@
+package mongodb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Set of values for the BSON binary vector layout. The first byte of the
+// payload is the element type, the second is the number of padding bits for
+// packed bit vectors, and the rest are the elements in little endian order.
+const (
+	binaryVectorSubtype byte = 0x09
+	vectorFloat32       byte = 0x27
+	vectorHeaderSize         = 2
+)
+
+var tFloat32Slice = reflect.TypeOf([]float32(nil))
+
+// NewRegistry returns a registry that encodes and decodes []float32 values
+// as packed BSON binary vectors. Decoding still accepts arrays of numbers so
+// documents written before the switch can be read.
+func NewRegistry() *bsoncodec.Registry {
+	reg := bson.NewRegistry()
+	reg.RegisterTypeEncoder(tFloat32Slice, bsoncodec.ValueEncoderFunc(vectorEncodeValue))
+	reg.RegisterTypeDecoder(tFloat32Slice, bsoncodec.ValueDecoderFunc(vectorDecodeValue))
+
+	return reg
+}
+
+// EncodeVector packs the vector into a BSON binary vector.
+func EncodeVector(vec []float32) primitive.Binary {
+	data := make([]byte, vectorHeaderSize+4*len(vec))
+	data[0] = vectorFloat32
+
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(data[vectorHeaderSize+4*i:], math.Float32bits(v))
+	}
+
+	return primitive.Binary{Subtype: binaryVectorSubtype, Data: data}
+}
+
+// DecodeVector unpacks a BSON binary vector of float32 elements.
+func DecodeVector(bin primitive.Binary) ([]float32, error) {
+	if bin.Subtype != binaryVectorSubtype {
+		return nil, fmt.Errorf("binary subtype %#x is not a vector", bin.Subtype)
+	}
+
+	data := bin.Data
+	if len(data) < vectorHeaderSize {
+		return nil, errors.New("binary vector is missing its header")
+	}
+
+	if data[0] != vectorFloat32 {
+		return nil, fmt.Errorf("binary vector element type %#x is not float32", data[0])
+	}
+
+	data = data[vectorHeaderSize:]
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("binary vector length %d is not a multiple of 4", len(data))
+	}
+
+	vec := make([]float32, len(data)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+
+	return vec, nil
+}
+
+// =============================================================================
+
+func vectorEncodeValue(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tFloat32Slice {
+		return bsoncodec.ValueEncoderError{Name: "vectorEncodeValue", Types: []reflect.Type{tFloat32Slice}, Received: val}
+	}
+
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+
+	bin := EncodeVector(val.Interface().([]float32))
+
+	return vw.WriteBinaryWithSubtype(bin.Data, bin.Subtype)
+}
+
+func vectorDecodeValue(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tFloat32Slice {
+		return bsoncodec.ValueDecoderError{Name: "vectorDecodeValue", Types: []reflect.Type{tFloat32Slice}, Received: val}
+	}
+
+	switch vr.Type() {
+	case bsontype.Null:
+		val.Set(reflect.Zero(tFloat32Slice))
+		return vr.ReadNull()
+
+	case bsontype.Binary:
+		data, subtype, err := vr.ReadBinary()
+		if err != nil {
+			return fmt.Errorf("read binary: %w", err)
+		}
+
+		vec, err := DecodeVector(primitive.Binary{Subtype: subtype, Data: data})
+		if err != nil {
+			return err
+		}
+
+		val.Set(reflect.ValueOf(vec))
+		return nil
+
+	case bsontype.Array:
+		vec, err := readNumberArray(vr)
+		if err != nil {
+			return err
+		}
+
+		val.Set(reflect.ValueOf(vec))
+		return nil
+	}
+
+	return fmt.Errorf("cannot decode %v into a []float32", vr.Type())
+}
+
+func readNumberArray(vr bsonrw.ValueReader) ([]float32, error) {
+	ar, err := vr.ReadArray()
+	if err != nil {
+		return nil, fmt.Errorf("read array: %w", err)
+	}
+
+	vec := make([]float32, 0)
+	for {
+		evr, err := ar.ReadValue()
+		if errors.Is(err, bsonrw.ErrEOA) {
+			return vec, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read value: %w", err)
+		}
+
+		var f float64
+		switch evr.Type() {
+		case bsontype.Double:
+			f, err = evr.ReadDouble()
+		case bsontype.Int32:
+			var i int32
+			i, err = evr.ReadInt32()
+			f = float64(i)
+		case bsontype.Int64:
+			var i int64
+			i, err = evr.ReadInt64()
+			f = float64(i)
+		default:
+			return nil, fmt.Errorf("cannot decode %v into a float32", evr.Type())
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("read number: %w", err)
+		}
+
+		vec = append(vec, float32(f))
+	}
+}
@@ -0,0 +1,102 @@
+package mongodb
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEncodeDecodeVector(t *testing.T) {
+	tests := []struct {
+		name string
+		vec  []float32
+	}{
+		{"empty", []float32{}},
+		{"single", []float32{1.5}},
+		{"signs", []float32{-1, 0, 1}},
+		{"extremes", []float32{math.MaxFloat32, math.SmallestNonzeroFloat32, float32(math.Inf(-1))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := EncodeVector(tt.vec)
+
+			if bin.Subtype != binaryVectorSubtype {
+				t.Fatalf("subtype: got %#x, exp %#x", bin.Subtype, binaryVectorSubtype)
+			}
+
+			if exp := vectorHeaderSize + 4*len(tt.vec); len(bin.Data) != exp {
+				t.Fatalf("length: got %d, exp %d", len(bin.Data), exp)
+			}
+
+			got, err := DecodeVector(bin)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+
+			if !slices.Equal(got, tt.vec) {
+				t.Fatalf("vector: got %v, exp %v", got, tt.vec)
+			}
+		})
+	}
+}
+
+func TestDecodeVectorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		bin  primitive.Binary
+	}{
+		{"subtype", primitive.Binary{Subtype: 0x00, Data: []byte{vectorFloat32, 0}}},
+		{"header", primitive.Binary{Subtype: binaryVectorSubtype, Data: []byte{vectorFloat32}}},
+		{"element type", primitive.Binary{Subtype: binaryVectorSubtype, Data: []byte{0x03, 0, 0, 0, 0, 0}}},
+		{"length", primitive.Binary{Subtype: binaryVectorSubtype, Data: []byte{vectorFloat32, 0, 1, 2, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeVector(tt.bin); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	type document struct {
+		Embedding []float32 `bson:"embedding"`
+	}
+
+	tests := []struct {
+		name string
+		doc  any
+		exp  []float32
+	}{
+		{"binary", document{Embedding: []float32{0.25, -2}}, []float32{0.25, -2}},
+		{"null", document{}, nil},
+		{"doubles", bson.M{"embedding": bson.A{0.5, 1.0}}, []float32{0.5, 1}},
+		{"integers", bson.M{"embedding": bson.A{int32(1), int64(2)}}, []float32{1, 2}},
+	}
+
+	reg := NewRegistry()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.MarshalWithRegistry(reg, tt.doc)
+			if err != nil {
+				t.Fatalf("marshal: %s", err)
+			}
+
+			var got document
+			if err := bson.UnmarshalWithRegistry(reg, data, &got); err != nil {
+				t.Fatalf("unmarshal: %s", err)
+			}
+
+			if !slices.Equal(got.Embedding, tt.exp) || (got.Embedding == nil) != (tt.exp == nil) {
+				t.Fatalf("embedding: got %v, exp %v", got.Embedding, tt.exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package word2vec
+
+/*
+#include <stdlib.h>
+#include "libw2v/include/w2v.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// DocNearest represents the document ID and the percent of closeness.
+type DocNearest struct {
+	ID       uint64
+	Distance float32
+}
+
+// =============================================================================
+
+// DocModel represents a store of document vectors keyed by document ID, such
+// as the vectors returned by Model.Embedding. Vectors are normalized when
+// they're stored, so they're compared the same way words are. A document
+// model is safe for concurrent use by multiple goroutines.
+type DocModel struct {
+	vectorSize int
+
+	mu sync.RWMutex
+	h  unsafe.Pointer
+}
+
+// NewDocModel constructs an empty document model for vectors of the
+// specified size. Call Close when the model is no longer needed.
+func NewDocModel(vector int) (*DocModel, error) {
+	if vector <= 0 || vector > 0xFFFF {
+		return nil, fmt.Errorf("invalid vector size %d", vector)
+	}
+
+	return newDocModel(C.NewDocModel(C.uint16_t(vector))), nil
+}
+
+// LoadDocModel takes a file written by Save and loads it for processing.
+// When vector isn't zero, it must match the vector size of the model.
+func LoadDocModel(fileModel string, vector int) (*DocModel, error) {
+	name := C.CString(fileModel)
+	defer C.free(unsafe.Pointer(name))
+
+	h := C.LoadDocModel(name)
+	if uintptr(h) == 0 {
+		return nil, errors.New("unable to load document model")
+	}
+
+	d := newDocModel(h)
+
+	if d.vectorSize == 0 {
+		d.Close()
+		return nil, errors.New("document model has no vector size")
+	}
+
+	if vector != 0 && vector != d.vectorSize {
+		d.Close()
+		return nil, fmt.Errorf("document model vector size is %d, not %d", d.vectorSize, vector)
+	}
+
+	return d, nil
+}
+
+// Save writes the document model to the specified file.
+func (d *DocModel) Save(fileModel string) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.h == nil {
+		return ErrClosed
+	}
+
+	name := C.CString(fileModel)
+	defer C.free(unsafe.Pointer(name))
+
+	if C.SaveDocModel(d.h, name) == 0 {
+		return errors.New("unable to save document model")
+	}
+
+	return nil
+}
+
+// Close releases the memory held by the document model. Calls made after
+// Close return ErrClosed.
+func (d *DocModel) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return nil
+	}
+
+	C.FreeDocModel(d.h)
+	d.h = nil
+
+	runtime.SetFinalizer(d, nil)
+
+	return nil
+}
+
+// Dim returns the number of dimensions of the document vectors.
+func (d *DocModel) Dim() int {
+	return d.vectorSize
+}
+
+// Size returns the number of documents in the model.
+func (d *DocModel) Size() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.h == nil {
+		return 0
+	}
+
+	return int(C.DocModelSize(d.h))
+}
+
+// Set stores the vector under the document ID, replacing the vector already
+// stored under that ID.
+func (d *DocModel) Set(id uint64, vector []float32) error {
+	if err := d.checkVector(vector); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return ErrClosed
+	}
+
+	if C.DocSet(d.h, C.size_t(id), (*C.float)(unsafe.Pointer(&vector[0]))) == 0 {
+		return errors.New("unable to store a zero vector")
+	}
+
+	return nil
+}
+
+// Erase removes the document from the model.
+func (d *DocModel) Erase(id uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h == nil {
+		return ErrClosed
+	}
+
+	C.DocErase(d.h, C.size_t(id))
+
+	return nil
+}
+
+// Lookup nearest documents to the vector. The length of seq is the number
+// of documents to find. A document with the same vector as the query isn't
+// returned, so looking up a stored document finds the others. When the
+// model has fewer neighbors, the remaining entries are set to their zero
+// value.
+func (d *DocModel) Lookup(vector []float32, seq []DocNearest) error {
+	if err := d.checkVector(vector); err != nil {
+		return err
+	}
+
+	if len(seq) == 0 {
+		return errors.New("nearest buffer is empty")
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.h == nil {
+		return ErrClosed
+	}
+
+	bag := C.DocLookup(d.h, (*C.float)(unsafe.Pointer(&vector[0])), C.size_t(len(seq)))
+	if bag.ids == nil || bag.seq == nil {
+		return errors.New("unable to lookup a zero vector")
+	}
+
+	defer C.free(unsafe.Pointer(bag.ids))
+	defer C.free(unsafe.Pointer(bag.seq))
+
+	n := int(bag.count)
+	ids := unsafe.Slice((*C.size_t)(bag.ids), n)
+	seqd := unsafe.Slice((*float32)(bag.seq), n)
+
+	for i := range seq {
+		if i >= n {
+			seq[i] = DocNearest{}
+			continue
+		}
+
+		seq[i] = DocNearest{
+			ID:       uint64(ids[i]),
+			Distance: seqd[i],
+		}
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+func newDocModel(h unsafe.Pointer) *DocModel {
+	d := DocModel{
+		vectorSize: int(C.DocVectorSize(h)),
+		h:          h,
+	}
+
+	runtime.SetFinalizer(&d, func(d *DocModel) {
+		d.Close()
+	})
+
+	return &d
+}
+
+func (d *DocModel) checkVector(vector []float32) error {
+	if len(vector) != d.vectorSize {
+		return fmt.Errorf("vector buffer has %d elements, model has %d dimensions", len(vector), d.vectorSize)
+	}
+
+	return nil
+}
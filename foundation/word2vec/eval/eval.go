@@ -0,0 +1,607 @@
+// Package eval measures the quality of word vectors, so models trained
+// with different settings, like CBOW and Skip-Gram, can be compared. Word
+// similarity files hold pairs of words scored by people, like WordSim-353,
+// and are scored with the Spearman correlation. Analogy files use the
+// questions-words.txt format of the original word2vec tool and are scored
+// with the accuracy of every section. Both report the coverage of the
+// vocabulary, since questions with unknown words are skipped.
+package eval
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Model represents a model whose word vectors can be evaluated. Both
+// word2vec.Model and purego.Model can be evaluated.
+type Model interface {
+	Dim() int
+	Words() []string
+	VectorOf(word string, vector []float32) error
+}
+
+// Config represents the settings of an evaluation.
+type Config struct {
+	// MaxWords represents the number of most frequent words of the model, in
+	// the order returned by Words, used to answer analogy questions. Zero
+	// uses every word.
+	// Ex: 30000
+	MaxWords int
+
+	// FoldCase represents if words are compared in lower case, since the
+	// questions-words.txt file is capitalized. When words of the vocabulary
+	// only differ by case, the first one returned by Words is used.
+	// Ex: true
+	FoldCase bool
+}
+
+// NewConfigDefault defines the settings of the compute-accuracy tool of the
+// original word2vec.
+func NewConfigDefault() Config {
+	return Config{
+		MaxWords: 30000,
+		FoldCase: true,
+	}
+}
+
+// key returns the form of the word used to compare it.
+func (c Config) key(word string) string {
+	if c.FoldCase {
+		return strings.ToLower(word)
+	}
+
+	return word
+}
+
+// =============================================================================
+
+// Pair represents a pair of words and their similarity scored by people.
+type Pair struct {
+	Word1 string
+	Word2 string
+	Score float64
+}
+
+// LoadPairs reads the word pairs from the specified file.
+func LoadPairs(filePairs string) ([]Pair, error) {
+	f, err := os.Open(filePairs)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	return ReadPairs(f)
+}
+
+// ReadPairs reads the word pairs, one "word1 word2 score" line per pair
+// separated by tabs or spaces. Empty lines, lines starting with '#' and a
+// first line without a score, the header of the TSV files, are skipped.
+func ReadPairs(r io.Reader) ([]Pair, error) {
+	var pairs []Pair
+
+	scanner := bufio.NewScanner(r)
+
+	var line int
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: wrong word pair format", line)
+		}
+
+		score, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			if len(pairs) == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: score: %w", line, err)
+		}
+
+		pairs = append(pairs, Pair{
+			Word1: fields[0],
+			Word2: fields[1],
+			Score: score,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	return pairs, nil
+}
+
+// SimilarityResult represents the result of scoring word pairs.
+type SimilarityResult struct {
+	// Pairs is the number of pairs and Covered the number of pairs with
+	// both words in the vocabulary, which are the ones scored.
+	Pairs   int
+	Covered int
+
+	// Spearman is the rank correlation between the scores given by people
+	// and the cosine similarity of the word vectors, from -1 to 1.
+	Spearman float64
+
+	// OOV holds the words missing from the vocabulary in alphabetical order.
+	OOV []string
+}
+
+// Coverage returns the ratio of the pairs that were scored.
+func (r SimilarityResult) Coverage() float64 {
+	if r.Pairs == 0 {
+		return 0
+	}
+
+	return float64(r.Covered) / float64(r.Pairs)
+}
+
+// Similarity scores the word pairs with the Spearman correlation between
+// the scores given by people and the cosine similarity of the vectors.
+// Pairs with a word missing from the vocabulary are skipped, even when the
+// model composes vectors for unknown words from subwords. MaxWords isn't
+// used, every word of the model is part of the vocabulary.
+func Similarity(model Model, pairs []Pair, config Config) (SimilarityResult, error) {
+	vocab := vocabulary(model.Words(), config)
+
+	result := SimilarityResult{
+		Pairs: len(pairs),
+	}
+
+	oov := make(map[string]bool)
+
+	var human, cosine []float64
+
+	vec1 := make([]float32, model.Dim())
+	vec2 := make([]float32, model.Dim())
+
+	for _, p := range pairs {
+		word1, word2 := config.key(p.Word1), config.key(p.Word2)
+
+		missing := false
+		for _, word := range []string{word1, word2} {
+			if _, exists := vocab[word]; !exists {
+				oov[word] = true
+				missing = true
+			}
+		}
+
+		if missing {
+			continue
+		}
+
+		if err := model.VectorOf(vocab[word1], vec1); err != nil {
+			return SimilarityResult{}, fmt.Errorf("word %q: %w", vocab[word1], err)
+		}
+
+		if err := model.VectorOf(vocab[word2], vec2); err != nil {
+			return SimilarityResult{}, fmt.Errorf("word %q: %w", vocab[word2], err)
+		}
+
+		human = append(human, p.Score)
+		cosine = append(cosine, float64(cosineSimilarity(vec1, vec2)))
+	}
+
+	result.Covered = len(human)
+	result.Spearman = spearman(human, cosine)
+	result.OOV = sortedWords(oov)
+
+	return result, nil
+}
+
+// =============================================================================
+
+// Question represents an analogy question: A is to B as C is to D.
+type Question struct {
+	Section string
+	A       string
+	B       string
+	C       string
+	D       string
+}
+
+// LoadQuestions reads the analogy questions from the specified file.
+func LoadQuestions(fileQuestions string) ([]Question, error) {
+	f, err := os.Open(fileQuestions)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	return ReadQuestions(f)
+}
+
+// ReadQuestions reads analogy questions in the questions-words.txt format:
+// a ": section" line starts a section, followed by one "a b c d" line per
+// question.
+func ReadQuestions(r io.Reader) ([]Question, error) {
+	var questions []Question
+	var section string
+
+	scanner := bufio.NewScanner(r)
+
+	var line int
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, ":") {
+			section = strings.TrimSpace(text[1:])
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: wrong analogy question format", line)
+		}
+
+		questions = append(questions, Question{
+			Section: section,
+			A:       fields[0],
+			B:       fields[1],
+			C:       fields[2],
+			D:       fields[3],
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	return questions, nil
+}
+
+// SectionResult represents the result of the analogy questions of a
+// section.
+type SectionResult struct {
+	Section string
+
+	// Questions is the number of questions and Covered the number of
+	// questions with all four words in the vocabulary, which are the ones
+	// answered. Correct is the number of right answers.
+	Questions int
+	Covered   int
+	Correct   int
+}
+
+// Accuracy returns the ratio of right answers to the answered questions.
+func (r SectionResult) Accuracy() float64 {
+	if r.Covered == 0 {
+		return 0
+	}
+
+	return float64(r.Correct) / float64(r.Covered)
+}
+
+// Coverage returns the ratio of the questions that were answered.
+func (r SectionResult) Coverage() float64 {
+	if r.Questions == 0 {
+		return 0
+	}
+
+	return float64(r.Covered) / float64(r.Questions)
+}
+
+// AnalogyResult represents the result of answering analogy questions.
+type AnalogyResult struct {
+	// Sections holds the result of every section in file order and Total
+	// the result of all the questions.
+	Sections []SectionResult
+	Total    SectionResult
+
+	// OOV holds the words missing from the vocabulary in alphabetical order.
+	OOV []string
+}
+
+// Analogy answers the questions with the word closest to B - A + C by
+// cosine similarity, leaving A, B and C out, and reports the accuracy of
+// every section. When MaxWords isn't zero, only the most frequent words of
+// the model are used as the vocabulary.
+func Analogy(model Model, questions []Question, config Config) (AnalogyResult, error) {
+	if config.MaxWords < 0 {
+		return AnalogyResult{}, errors.New("max words must not be negative")
+	}
+
+	words := model.Words()
+	if config.MaxWords > 0 && len(words) > config.MaxWords {
+		words = words[:config.MaxWords]
+	}
+
+	space, err := newSpace(model, words, config)
+	if err != nil {
+		return AnalogyResult{}, err
+	}
+
+	// The questions are compared in the form of the vocabulary keys.
+	questions = slices.Clone(questions)
+	for i, q := range questions {
+		questions[i].A, questions[i].B = config.key(q.A), config.key(q.B)
+		questions[i].C, questions[i].D = config.key(q.C), config.key(q.D)
+	}
+
+	result := AnalogyResult{
+		Total: SectionResult{Section: "total", Questions: len(questions)},
+	}
+
+	oov := make(map[string]bool)
+	sections := make(map[string]int)
+	answers := make([]int, len(questions))
+
+	var covered []int
+
+	for i, q := range questions {
+		idx, exists := sections[q.Section]
+		if !exists {
+			idx = len(result.Sections)
+			sections[q.Section] = idx
+			result.Sections = append(result.Sections, SectionResult{Section: q.Section})
+		}
+
+		result.Sections[idx].Questions++
+
+		answers[i] = -1
+
+		missing := false
+		for _, word := range []string{q.A, q.B, q.C, q.D} {
+			if _, exists := space.index[word]; !exists {
+				oov[word] = true
+				missing = true
+			}
+		}
+
+		if !missing {
+			covered = append(covered, i)
+		}
+	}
+
+	// The questions are answered in parallel, every answer is a scan of the
+	// whole vocabulary.
+	var wg sync.WaitGroup
+	workers := runtime.GOMAXPROCS(0)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			target := make([]float32, space.dim)
+
+			for i := w; i < len(covered); i += workers {
+				answers[covered[i]] = space.answer(questions[covered[i]], target)
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	for _, i := range covered {
+		q := questions[i]
+		section := &result.Sections[sections[q.Section]]
+
+		section.Covered++
+		result.Total.Covered++
+
+		if answers[i] == space.index[q.D] {
+			section.Correct++
+			result.Total.Correct++
+		}
+	}
+
+	result.OOV = sortedWords(oov)
+
+	return result, nil
+}
+
+// =============================================================================
+
+// vocabulary maps the key of every word to the word of the model, the
+// first word wins when several words share a key.
+func vocabulary(words []string, config Config) map[string]string {
+	vocab := make(map[string]string, len(words))
+	for _, word := range words {
+		key := config.key(word)
+		if _, exists := vocab[key]; !exists {
+			vocab[key] = word
+		}
+	}
+
+	return vocab
+}
+
+// space holds the unit length vectors of the words used to answer analogy
+// questions in a single matrix, one row per word key.
+type space struct {
+	dim    int
+	index  map[string]int
+	matrix []float32
+}
+
+func newSpace(model Model, words []string, config Config) (*space, error) {
+	s := space{
+		dim:    model.Dim(),
+		index:  make(map[string]int, len(words)),
+		matrix: make([]float32, 0, len(words)*model.Dim()),
+	}
+
+	for _, word := range words {
+		key := config.key(word)
+		if _, exists := s.index[key]; exists {
+			continue
+		}
+
+		i := len(s.index)
+		s.matrix = s.matrix[:(i+1)*s.dim]
+		row := s.row(i)
+
+		if err := model.VectorOf(word, row); err != nil {
+			return nil, fmt.Errorf("word %q: %w", word, err)
+		}
+
+		unit(row)
+		s.index[key] = i
+	}
+
+	return &s, nil
+}
+
+func (s *space) row(idx int) []float32 {
+	return s.matrix[idx*s.dim : (idx+1)*s.dim]
+}
+
+// answer returns the index of the word closest to B - A + C.
+func (s *space) answer(q Question, target []float32) int {
+	a, b, c := s.index[q.A], s.index[q.B], s.index[q.C]
+
+	va, vb, vc := s.row(a), s.row(b), s.row(c)
+	for i := range target {
+		target[i] = vb[i] - va[i] + vc[i]
+	}
+
+	unit(target)
+
+	best := -1
+	bestScore := float32(math.Inf(-1))
+
+	for idx := 0; idx < len(s.index); idx++ {
+		if idx == a || idx == b || idx == c {
+			continue
+		}
+
+		var dot float32
+		for i, v := range s.row(idx) {
+			dot += v * target[i]
+		}
+
+		if dot > bestScore {
+			best = idx
+			bestScore = dot
+		}
+	}
+
+	return best
+}
+
+// unit scales the vector to a length of one.
+func unit(vec []float32) {
+	var sum float32
+	for _, v := range vec {
+		sum += v * v
+	}
+
+	if sum <= 0 {
+		return
+	}
+
+	length := float32(math.Sqrt(float64(sum)))
+	for i := range vec {
+		vec[i] /= length
+	}
+}
+
+func cosineSimilarity(x []float32, y []float32) float32 {
+	var dot, sumX, sumY float32
+	for i := range x {
+		dot += x[i] * y[i]
+		sumX += x[i] * x[i]
+		sumY += y[i] * y[i]
+	}
+
+	if sumX <= 0 || sumY <= 0 {
+		return 0
+	}
+
+	return dot / float32(math.Sqrt(float64(sumX))*math.Sqrt(float64(sumY)))
+}
+
+// spearman returns the Pearson correlation of the ranks of the values,
+// with tied values given the mean of their ranks.
+func spearman(x []float64, y []float64) float64 {
+	if len(x) < 2 {
+		return 0
+	}
+
+	rx, ry := ranks(x), ranks(y)
+
+	var meanX, meanY float64
+	for i := range rx {
+		meanX += rx[i]
+		meanY += ry[i]
+	}
+	meanX /= float64(len(rx))
+	meanY /= float64(len(ry))
+
+	var cov, varX, varY float64
+	for i := range rx {
+		dx, dy := rx[i]-meanX, ry[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+
+	if varX == 0 || varY == 0 {
+		return 0
+	}
+
+	return cov / math.Sqrt(varX*varY)
+}
+
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		return values[order[i]] < values[order[j]]
+	})
+
+	r := make([]float64, len(values))
+
+	for i := 0; i < len(order); {
+		j := i
+		for j+1 < len(order) && values[order[j+1]] == values[order[i]] {
+			j++
+		}
+
+		// Ranks start at one, tied values share the mean rank.
+		rank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			r[order[k]] = rank
+		}
+
+		i = j + 1
+	}
+
+	return r
+}
+
+func sortedWords(set map[string]bool) []string {
+	words := make([]string, 0, len(set))
+	for word := range set {
+		words = append(words, word)
+	}
+
+	sort.Strings(words)
+
+	return words
+}
@@ -0,0 +1,275 @@
+package eval
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/word2vec/purego"
+)
+
+// model reads a GloVe fixture, the words are returned in the file order.
+func model(t *testing.T, glove string) *purego.Model {
+	t.Helper()
+
+	m, err := purego.ReadGloVe(strings.NewReader(glove), 0)
+	if err != nil {
+		t.Fatalf("read model: %s", err)
+	}
+
+	return &m
+}
+
+func TestRanks(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		exp    []float64
+	}{
+		{"empty", []float64{}, []float64{}},
+		{"single", []float64{5}, []float64{1}},
+		{"sorted", []float64{1, 2, 3}, []float64{1, 2, 3}},
+		{"reversed", []float64{3, 2, 1}, []float64{3, 2, 1}},
+		{"ties", []float64{10, 20, 10, 30}, []float64{1.5, 3, 1.5, 4}},
+		{"all tied", []float64{7, 7, 7}, []float64{2, 2, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ranks(tt.values); !slices.Equal(got, tt.exp) {
+				t.Fatalf("ranks: got %v, exp %v", got, tt.exp)
+			}
+		})
+	}
+}
+
+func TestSpearman(t *testing.T) {
+	tests := []struct {
+		name string
+		x    []float64
+		y    []float64
+		exp  float64
+	}{
+		{"fewer than two values", []float64{1}, []float64{2}, 0},
+		{"perfect", []float64{1, 2, 3, 4}, []float64{10, 20, 30, 40}, 1},
+		{"monotonic", []float64{1, 2, 3, 4}, []float64{1, 4, 9, 100}, 1},
+		{"inverse", []float64{1, 2, 3, 4}, []float64{4, 3, 2, 1}, -1},
+		{"zero variance", []float64{1, 2, 3}, []float64{5, 5, 5}, 0},
+		{"one swap", []float64{1, 2, 3, 4, 5}, []float64{1, 2, 3, 5, 4}, 0.9},
+		{"ties", []float64{1, 2, 2, 3}, []float64{1, 2, 3, 4}, 0.9486832980505138},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spearman(tt.x, tt.y); math.Abs(got-tt.exp) > 1e-9 {
+				t.Fatalf("spearman: got %v, exp %v", got, tt.exp)
+			}
+		})
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	model := model(t, "king 1 1\nqueen 1 3\nman 3 0\nwoman 3 2\nKing -1 0\n")
+
+	pairs := []Pair{
+		{Word1: "KING", Word2: "Queen", Score: 8},
+		{Word1: "Man", Word2: "woman", Score: 6},
+		{Word1: "king", Word2: "man", Score: 2},
+	}
+
+	questions := []Question{
+		{Section: "gender", A: "Man", B: "Woman", C: "King", D: "Queen"},
+	}
+
+	tests := []struct {
+		name     string
+		foldCase bool
+		covered  int
+		correct  int
+		oov      []string
+	}{
+		{"exact case", false, 1, 0, []string{"KING", "Man", "Queen", "Woman"}},
+		{"fold case", true, 3, 1, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewConfigDefault()
+			config.FoldCase = tt.foldCase
+
+			sim, err := Similarity(model, pairs, config)
+			if err != nil {
+				t.Fatalf("similarity: %s", err)
+			}
+
+			if sim.Covered != tt.covered {
+				t.Fatalf("similarity covered: got %d, exp %d", sim.Covered, tt.covered)
+			}
+
+			analogy, err := Analogy(model, questions, config)
+			if err != nil {
+				t.Fatalf("analogy: %s", err)
+			}
+
+			// With the case folded, "king" wins over "King" which comes later.
+			if analogy.Total.Correct != tt.correct {
+				t.Fatalf("analogy correct: got %d, exp %d", analogy.Total.Correct, tt.correct)
+			}
+
+			oov := slices.Concat(sim.OOV, analogy.OOV)
+			slices.Sort(oov)
+			oov = slices.Compact(oov)
+
+			if !slices.Equal(oov, tt.oov) {
+				t.Fatalf("oov: got %q, exp %q", oov, tt.oov)
+			}
+		})
+	}
+}
+
+func TestMaxWords(t *testing.T) {
+	// The last word is the exact answer, queen is the closest of the others.
+	model := model(t, "man 1 0\nwoman 0 1\nking 1 1\nqueen -1 2\nroyal -0.2929 1.7071\n")
+
+	questions := []Question{
+		{Section: "gender", A: "man", B: "woman", C: "king", D: "queen"},
+	}
+
+	tests := []struct {
+		name     string
+		maxWords int
+		covered  int
+		correct  int
+		oov      []string
+	}{
+		{"every word", 0, 1, 0, []string{}},
+		{"most frequent words", 4, 1, 1, []string{}},
+		{"answer left out", 3, 0, 0, []string{"queen"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewConfigDefault()
+			config.MaxWords = tt.maxWords
+
+			got, err := Analogy(model, questions, config)
+			if err != nil {
+				t.Fatalf("analogy: %s", err)
+			}
+
+			if got.Total.Covered != tt.covered {
+				t.Fatalf("covered: got %d, exp %d", got.Total.Covered, tt.covered)
+			}
+
+			if got.Total.Correct != tt.correct {
+				t.Fatalf("correct: got %d, exp %d", got.Total.Correct, tt.correct)
+			}
+
+			if !slices.Equal(got.OOV, tt.oov) {
+				t.Fatalf("oov: got %q, exp %q", got.OOV, tt.oov)
+			}
+		})
+	}
+}
+
+func TestAnalogySections(t *testing.T) {
+	model := model(t, `man 1 0 0 0 0 0
+woman 0 1 0 0 0 0
+king 1 0 1 0 0 0
+queen 0 1 1 0 0 0
+france 0 0 0 1 0 0
+italy 0 0 0 0 1 0
+paris 0 0 0 1 0 1
+rome 0 0 0 0 1 1
+berlin 0 0 0 0 0 1
+`)
+
+	questions := []Question{
+		{Section: "gender", A: "man", B: "woman", C: "king", D: "queen"},
+		{Section: "capital", A: "france", B: "paris", C: "italy", D: "rome"},
+		{Section: "gender", A: "man", B: "woman", C: "boy", D: "girl"},
+		{Section: "capital", A: "italy", B: "rome", C: "france", D: "berlin"},
+	}
+
+	got, err := Analogy(model, questions, NewConfigDefault())
+	if err != nil {
+		t.Fatalf("analogy: %s", err)
+	}
+
+	exp := AnalogyResult{
+		Sections: []SectionResult{
+			{Section: "gender", Questions: 2, Covered: 1, Correct: 1},
+			{Section: "capital", Questions: 2, Covered: 2, Correct: 1},
+		},
+		Total: SectionResult{Section: "total", Questions: 4, Covered: 3, Correct: 2},
+		OOV:   []string{"boy", "girl"},
+	}
+
+	if !slices.Equal(got.Sections, exp.Sections) {
+		t.Fatalf("sections: got %+v, exp %+v", got.Sections, exp.Sections)
+	}
+
+	if got.Total != exp.Total {
+		t.Fatalf("total: got %+v, exp %+v", got.Total, exp.Total)
+	}
+
+	if !slices.Equal(got.OOV, exp.OOV) {
+		t.Fatalf("oov: got %q, exp %q", got.OOV, exp.OOV)
+	}
+
+	if acc := got.Sections[1].Accuracy(); acc != 0.5 {
+		t.Fatalf("capital accuracy: got %v, exp %v", acc, 0.5)
+	}
+}
+
+func TestLoadPairs(t *testing.T) {
+	pairs, err := LoadPairs("../../../zarf/data/wordsim.tsv")
+	if err != nil {
+		t.Fatalf("loadPairs: %s", err)
+	}
+
+	if len(pairs) != 24 {
+		t.Fatalf("pairs: got %d, exp %d", len(pairs), 24)
+	}
+
+	exp := []Pair{
+		{Word1: "phone", Word2: "cellphone", Score: 9.5},
+		{Word1: "cover", Word2: "issue", Score: 0.5},
+	}
+
+	if got := []Pair{pairs[0], pairs[len(pairs)-1]}; !slices.Equal(got, exp) {
+		t.Fatalf("pairs: got %+v, exp %+v", got, exp)
+	}
+}
+
+func TestLoadQuestions(t *testing.T) {
+	questions, err := LoadQuestions("../../../zarf/data/questions-words.txt")
+	if err != nil {
+		t.Fatalf("loadQuestions: %s", err)
+	}
+
+	counts := make(map[string]int)
+	var sections []string
+
+	for _, q := range questions {
+		if counts[q.Section] == 0 {
+			sections = append(sections, q.Section)
+		}
+		counts[q.Section]++
+	}
+
+	if exp := []string{"gram-plural", "gram-comparative", "opposite"}; !slices.Equal(sections, exp) {
+		t.Fatalf("sections: got %q, exp %q", sections, exp)
+	}
+
+	if exp := map[string]int{"gram-plural": 8, "gram-comparative": 8, "opposite": 6}; !maps.Equal(counts, exp) {
+		t.Fatalf("questions: got %v, exp %v", counts, exp)
+	}
+
+	exp := Question{Section: "gram-plural", A: "Phone", B: "Phones", C: "Case", D: "Cases"}
+	if questions[0] != exp {
+		t.Fatalf("question: got %+v, exp %+v", questions[0], exp)
+	}
+}
@@ -0,0 +1,140 @@
+// Package export writes the vectors of a word2vec model in the formats used
+// by other tools: GloVe text, fastText .vec and the vectors.tsv and
+// metadata.tsv files loaded by the TensorBoard Embedding Projector. Both
+// word2vec.Model and purego.Model can be exported.
+package export
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Vectors represents a model whose word vectors can be exported.
+type Vectors interface {
+	Dim() int
+	Words() []string
+	VectorOf(word string, vector []float32) error
+}
+
+// =============================================================================
+
+// GloVe writes the vectors in the GloVe text format, one "word value..."
+// line per word with no header. Words are written in the order returned by
+// Words and the vectors are the normalized vectors held by the model.
+func GloVe(w io.Writer, model Vectors) error {
+	return write(w, model, false)
+}
+
+// Vec writes the vectors in the fastText .vec format, which is the word2vec
+// text format: a "words dimensions" header followed by one line per word.
+func Vec(w io.Writer, model Vectors) error {
+	return write(w, model, true)
+}
+
+// Projector writes the vectors and the words in the two files loaded by the
+// TensorBoard Embedding Projector. Each line of vectors holds the tab
+// separated values of one word and the same line of metadata holds the word.
+func Projector(vectors io.Writer, metadata io.Writer, model Vectors) error {
+	bv := bufio.NewWriter(vectors)
+	bm := bufio.NewWriter(metadata)
+
+	err := each(model, model.Words(), func(word string, vector []float32) error {
+		if strings.ContainsAny(word, "\t\r\n") {
+			return errors.New("word holds a tab or a line break")
+		}
+
+		bv.Write(appendVector(nil, vector, '\t'))
+		bv.WriteByte('\n')
+
+		bm.WriteString(word)
+		bm.WriteByte('\n')
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := bv.Flush(); err != nil {
+		return fmt.Errorf("write vectors: %w", err)
+	}
+
+	if err := bm.Flush(); err != nil {
+		return fmt.Errorf("write metadata: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+func write(w io.Writer, model Vectors, header bool) error {
+	bw := bufio.NewWriter(w)
+	words := model.Words()
+
+	if header {
+		fmt.Fprintf(bw, "%d %d\n", len(words), model.Dim())
+	}
+
+	buf := make([]byte, 0, 16*model.Dim())
+
+	err := each(model, words, func(word string, vector []float32) error {
+		if word == "" || strings.ContainsFunc(word, isSpace) {
+			return errors.New("word is empty or holds white space")
+		}
+
+		buf = append(buf[:0], word...)
+		buf = append(buf, ' ')
+		buf = appendVector(buf, vector, ' ')
+		buf = append(buf, '\n')
+
+		bw.Write(buf)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("write vectors: %w", err)
+	}
+
+	return nil
+}
+
+// each calls fn with the vector of every word in the list.
+func each(model Vectors, words []string, fn func(word string, vector []float32) error) error {
+	vector := make([]float32, model.Dim())
+
+	for _, word := range words {
+		if err := model.VectorOf(word, vector); err != nil {
+			return fmt.Errorf("word %q: %w", word, err)
+		}
+
+		if err := fn(word, vector); err != nil {
+			return fmt.Errorf("word %q: %w", word, err)
+		}
+	}
+
+	return nil
+}
+
+func appendVector(buf []byte, vector []float32, sep byte) []byte {
+	for i, v := range vector {
+		if i > 0 {
+			buf = append(buf, sep)
+		}
+		buf = strconv.AppendFloat(buf, float64(v), 'g', -1, 32)
+	}
+
+	return buf
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\v' || r == '\f'
+}
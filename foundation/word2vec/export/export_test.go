@@ -0,0 +1,178 @@
+package export
+
+import (
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/word2vec/purego"
+)
+
+// model reads a GloVe fixture, the words are returned in the file order.
+func model(t *testing.T, glove string) *purego.Model {
+	t.Helper()
+
+	m, err := purego.ReadGloVe(strings.NewReader(glove), 0)
+	if err != nil {
+		t.Fatalf("read model: %s", err)
+	}
+
+	return &m
+}
+
+// unknown is a model that has no vector for its words.
+type unknown struct {
+	*purego.Model
+}
+
+func (unknown) VectorOf(word string, vector []float32) error {
+	return errors.New("unknown tokens")
+}
+
+func TestWrite(t *testing.T) {
+	// The values have a root mean square of 1, so the model keeps them as
+	// they are.
+	model := model(t, "go -1 1 1 1\nrust 2 1e-7 0 0\n")
+
+	tests := []struct {
+		name     string
+		write    func(w io.Writer, model Vectors) error
+		vectors  string
+		metadata string
+	}{
+		{
+			name:    "glove",
+			write:   GloVe,
+			vectors: "go -1 1 1 1\nrust 2 1e-07 0 0\n",
+		},
+		{
+			name:    "vec",
+			write:   Vec,
+			vectors: "2 4\ngo -1 1 1 1\nrust 2 1e-07 0 0\n",
+		},
+		{
+			name:     "projector",
+			vectors:  "-1\t1\t1\t1\n2\t1e-07\t0\t0\n",
+			metadata: "go\nrust\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vecs, meta strings.Builder
+
+			var err error
+			switch tt.write {
+			case nil:
+				err = Projector(&vecs, &meta, model)
+			default:
+				err = tt.write(&vecs, model)
+			}
+
+			if err != nil {
+				t.Fatalf("write: %s", err)
+			}
+
+			if vecs.String() != tt.vectors {
+				t.Fatalf("vectors: got %q, exp %q", vecs.String(), tt.vectors)
+			}
+
+			if meta.String() != tt.metadata {
+				t.Fatalf("metadata: got %q, exp %q", meta.String(), tt.metadata)
+			}
+		})
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	tab, err := purego.Read(strings.NewReader("1 1\ntab\tword 1\n"), 0)
+	if err != nil {
+		t.Fatalf("read model: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		model Vectors
+		write func(model Vectors) error
+	}{
+		{
+			name:  "glove word with a space",
+			model: model(t, "go 1\nbad word 1\n"),
+			write: func(model Vectors) error { return GloVe(&strings.Builder{}, model) },
+		},
+		{
+			name:  "vec word with a tab",
+			model: &tab,
+			write: func(model Vectors) error { return Vec(&strings.Builder{}, model) },
+		},
+		{
+			name:  "projector word with a tab",
+			model: &tab,
+			write: func(model Vectors) error { return Projector(&strings.Builder{}, &strings.Builder{}, model) },
+		},
+		{
+			name:  "unknown vector",
+			model: unknown{model(t, "go 1\n")},
+			write: func(model Vectors) error { return GloVe(&strings.Builder{}, model) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(tt.model); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w io.Writer, model Vectors) error
+		read  func(r io.Reader, vector int) (purego.Model, error)
+	}{
+		{"glove", GloVe, purego.ReadGloVe},
+		{"vec", Vec, purego.Read},
+	}
+
+	src, err := purego.ReadGloVe(strings.NewReader("go 0.1 -2 3\nrust 4 0.5 -6\nzig 1e-3 1 1\n"), 3)
+	if err != nil {
+		t.Fatalf("read source: %s", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			if err := tt.write(&buf, &src); err != nil {
+				t.Fatalf("write: %s", err)
+			}
+
+			got, err := tt.read(strings.NewReader(buf.String()), src.Dim())
+			if err != nil {
+				t.Fatalf("read: %s", err)
+			}
+
+			if !slices.Equal(got.Words(), src.Words()) {
+				t.Fatalf("words: got %q, exp %q", got.Words(), src.Words())
+			}
+
+			exp := make([]float32, src.Dim())
+			vec := make([]float32, src.Dim())
+
+			for _, word := range src.Words() {
+				src.VectorOf(word, exp)
+				got.VectorOf(word, vec)
+
+				for i := range exp {
+					if math.Abs(float64(vec[i]-exp[i])) > 1e-6 {
+						t.Fatalf("vector %q: got %v, exp %v", word, vec, exp)
+					}
+				}
+			}
+		})
+	}
+}
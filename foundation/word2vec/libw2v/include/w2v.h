@@ -11,8 +11,34 @@ extern "C"
 {
 #endif
 
+  typedef void (*parseProgress_t)(uintptr_t handle, float percent);
+  typedef void (*vocabularyStats_t)(uintptr_t handle, size_t vocWords, size_t trainWords, size_t totalWords);
+  typedef void (*trainProgress_t)(uintptr_t handle, float alpha, float percent);
+
+  // progress_t holds the callbacks reporting training progress, any of them can be null.
+  // The handle is passed back to every callback. The train progress callback is
+  // called from the train threads concurrently.
+  struct progress_t
+  {
+    uintptr_t handle;
+    parseProgress_t parse;
+    vocabularyStats_t stats;
+    trainProgress_t train;
+  };
+
+  // a job lets another thread cancel a running Train call
+  void *NewJob(void);
+  void CancelJob(void *job);
+  void FreeJob(void *job);
+
+  // the train data is read from trainData when it isn't null, otherwise from fileTrain,
+  // training continues from the model in fileBase when it isn't empty,
+  // character n-gram vectors are trained when minN isn't zero
   void *Train(
       char *fileTrain,
+      const char *trainData,
+      size_t trainSize,
+      char *fileBase,
       char *fileStopWords,
       char *fileModel,
       uint16_t minWordFreq,
@@ -25,23 +51,67 @@ extern "C"
       uint8_t iterations,
       float alpha,
       uint8_t withSG,
+      uint8_t minN,
+      uint8_t maxN,
+      uint32_t buckets,
       char *wordDelimiterChars,
       char *endOfSentenceChars,
-      uint8_t verbose);
+      uint8_t verbose,
+      void *job,
+      struct progress_t progress);
   void *Load(const char *file);
   void Free(void *fd);
 
+  uint16_t VectorSize(void *fd);
+  size_t ModelSize(void *fd);
+  size_t Frequency(void *fd, const char *word);
+
+  struct words_t
+  {
+    char *buf;
+    size_t len;
+    size_t count;
+  };
+
+  struct words_t Words(void *fd);
+
+  // unknown words get a vector composed from their character n-grams when the model has them
   float *VectorOf(void *fd, const char *word);
-  float *Embedding(void *fd, const char *doc);
+
+  // documents are split into words with wordDelimiterChars, the default delimiters when it's null
+  float *Embedding(void *fd, const char *doc, const char *wordDelimiterChars);
 
   struct nearest_t
   {
     float *seq;
     size_t len;
     char *buf;
+    size_t count;
+  };
+
+  struct nearest_t Lookup(void *fd, const char *query, size_t k, const char *wordDelimiterChars);
+  struct nearest_t LookupVector(void *fd, const float *vector, size_t k);
+
+  // document models store vectors under document IDs
+  void *NewDocModel(uint16_t vectorSize);
+  void *LoadDocModel(const char *file);
+  uint8_t SaveDocModel(void *fd, const char *file);
+  void FreeDocModel(void *fd);
+
+  uint16_t DocVectorSize(void *fd);
+  size_t DocModelSize(void *fd);
+
+  uint8_t DocSet(void *fd, size_t id, const float *vector);
+  void DocErase(void *fd, size_t id);
+
+  struct docNearest_t
+  {
+    size_t *ids;
+    float *seq;
+    size_t count;
   };
 
-  struct nearest_t Lookup(void *fd, const char *query, size_t k);
+  struct docNearest_t DocLookup(void *fd, const float *vector, size_t k);
 #ifdef __cplusplus
 }
 #endif
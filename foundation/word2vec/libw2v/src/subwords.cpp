@@ -0,0 +1,34 @@
+/**
+ * @file
+ * @brief subwords class maps a word to the hash buckets of its character n-grams
+ * @copyright Apache License v.2 (http://www.apache.org/licenses/LICENSE-2.0)
+*/
+
+#include "subwords.hpp"
+
+namespace w2v {
+    void subwords_t::buckets(const std::string &_word, std::vector<std::size_t> &_buckets) const noexcept {
+        const std::string word = "<" + _word + ">";
+
+        for (std::size_t i = 0; i < word.size(); ++i) {
+            // n-grams start at the first byte of a UTF-8 character
+            if ((word[i] & 0xC0) == 0x80) {
+                continue;
+            }
+
+            uint32_t hash = 2166136261u;
+            std::size_t j = i;
+            for (std::size_t n = 1; j < word.size() && n <= m_maxN; ++n) {
+                do {
+                    hash ^= static_cast<uint8_t>(word[j++]);
+                    hash *= 16777619u;
+                } while (j < word.size() && (word[j] & 0xC0) == 0x80);
+
+                // a single '<' or '>' is not an n-gram
+                if (n >= m_minN && !(n == 1 && (i == 0 || j == word.size()))) {
+                    _buckets.push_back(hash % m_buckets);
+                }
+            }
+        }
+    }
+}
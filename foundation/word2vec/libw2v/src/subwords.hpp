@@ -0,0 +1,59 @@
+/**
+ * @file
+ * @brief subwords class maps a word to the hash buckets of its character n-grams
+ * @copyright Apache License v.2 (http://www.apache.org/licenses/LICENSE-2.0)
+*/
+
+#ifndef WORD2VEC_SUBWORDS_H
+#define WORD2VEC_SUBWORDS_H
+
+#include <cstdint>
+#include <string>
+#include <vector>
+
+namespace w2v {
+    /**
+     * @brief subwords class - character n-grams of a word, fastText style
+     *
+     * The word is wrapped in '<' and '>' so prefixes and suffixes differ from the same characters inside a
+     * word, n-grams are taken over UTF-8 characters and hashed with FNV-1a into a fixed number of buckets.
+     * Subword vectors are stored per bucket, so different n-grams can share a vector.
+    */
+    class subwords_t final {
+    private:
+        uint8_t m_minN;
+        uint8_t m_maxN;
+        uint32_t m_buckets;
+
+    public:
+        /**
+         * Constructs a subwords object
+         * @param _minN min length of character n-grams
+         * @param _maxN max length of character n-grams
+         * @param _buckets number of hash buckets
+        */
+        subwords_t(uint8_t _minN, uint8_t _maxN, uint32_t _buckets) noexcept:
+                m_minN(_minN), m_maxN(_maxN), m_buckets(_buckets) {}
+
+        /**
+         * Appends the bucket indexes of the character n-grams of a word
+         * @param _word word to split into n-grams
+         * @param[out] _buckets bucket indexes, an index is repeated when n-grams share a bucket
+        */
+        void buckets(const std::string &_word, std::vector<std::size_t> &_buckets) const noexcept;
+
+        /// @returns min length of character n-grams
+        inline uint8_t minN() const noexcept {return m_minN;}
+        /// @returns max length of character n-grams
+        inline uint8_t maxN() const noexcept {return m_maxN;}
+        /// @returns number of hash buckets
+        inline uint32_t bucketsNumber() const noexcept {return m_buckets;}
+
+        /// @returns true when the settings describe usable n-grams
+        inline bool valid() const noexcept {
+            return m_minN > 0 && m_maxN >= m_minN && m_buckets > 0;
+        }
+    };
+}
+
+#endif // WORD2VEC_SUBWORDS_H
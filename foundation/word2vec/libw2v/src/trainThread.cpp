@@ -40,7 +40,7 @@ namespace w2v {
         }
 
         m_hiddenLayerErrors.reset(new std::vector<float>(m_sharedData.trainSettings->size));
-        if (!m_sharedData.trainSettings->withSG) {
+        if (!m_sharedData.trainSettings->withSG || m_sharedData.subwords) {
             m_hiddenLayerVals.reset(new std::vector<float>(m_sharedData.trainSettings->size));
         }
 
@@ -51,13 +51,14 @@ namespace w2v {
         auto startFrom = shift * _id;
         auto stopAt = (_id == m_sharedData.trainSettings->threads - 1)
                       ? (m_sharedData.fileMapper->size() - 1) : (shift * (_id + 1));
-        m_wordReader.reset(new wordReader_t<fileMapper_t>(*m_sharedData.fileMapper,
+        m_wordReader.reset(new wordReader_t<mapper_t>(*m_sharedData.fileMapper,
                                                           m_sharedData.trainSettings->wordDelimiterChars,
                                                           m_sharedData.trainSettings->endOfSentenceChars,
                                                           startFrom, stopAt));
     }
 
     void trainThread_t::worker(std::vector<float> &_trainMatrix) noexcept {
+        const std::atomic<bool> *stop = m_sharedData.trainSettings->stop;
         for (auto i = m_sharedData.trainSettings->iterations; i > 0; --i) {
             bool exitFlag = false;
             std::size_t threadProcessedWords = 0;
@@ -67,6 +68,10 @@ namespace w2v {
                               * m_sharedData.vocabulary->trainWords();
             auto wordsPerAlpha = wordsPerAllThreads / 10000;
             while (!exitFlag) {
+                if (stop != nullptr && *stop) {
+                    return;
+                }
+
                 // calc alpha
                 if (threadProcessedWords - prvThreadProcessedWords > wordsPerAlpha) { // next 0.01% processed
                     *m_sharedData.processedWords += threadProcessedWords - prvThreadProcessedWords;
@@ -140,10 +145,7 @@ namespace w2v {
                 if (posRndWindow >= _sentence.size()) {
                     continue;
                 }
-                for (std::size_t k = 0; k < m_sharedData.trainSettings->size; ++k) {
-                    (*m_hiddenLayerVals)[k] += _trainMatrix[k + _sentence[posRndWindow]->index
-                                                           * m_sharedData.trainSettings->size];
-                }
+                addInput(_sentence[posRndWindow]->index, *m_hiddenLayerVals, _trainMatrix);
                 cw++;
             }
             if (cw == 0) {
@@ -169,10 +171,7 @@ namespace w2v {
                 if (posRndWindow >= _sentence.size()) {
                     continue;
                 }
-                for (std::size_t k = 0; k < m_sharedData.trainSettings->size; ++k) {
-                    _trainMatrix[k + _sentence[posRndWindow]->index * m_sharedData.trainSettings->size]
-                            += (*m_hiddenLayerErrors)[k];
-                }
+                updateInput(_sentence[posRndWindow]->index, *m_hiddenLayerErrors, _trainMatrix);
             }
         }
     }
@@ -190,6 +189,23 @@ namespace w2v {
                 if (posRndWindow >= _sentence.size()) {
                     continue;
                 }
+
+                if (m_sharedData.subwords) {
+                    // the input vector is composed from the word and its n-gram rows
+                    std::memset(m_hiddenLayerVals->data(), 0, m_hiddenLayerVals->size() * sizeof(float));
+                    std::memset(m_hiddenLayerErrors->data(), 0, m_hiddenLayerErrors->size() * sizeof(float));
+                    addInput(_sentence[posRndWindow]->index, *m_hiddenLayerVals, _trainMatrix);
+
+                    if (m_sharedData.trainSettings->withHS) {
+                        hierarchicalSoftmax(_sentence[i]->index, (*m_hiddenLayerErrors), *m_hiddenLayerVals, 0);
+                    } else {
+                        negativeSampling(_sentence[i]->index, (*m_hiddenLayerErrors), *m_hiddenLayerVals, 0);
+                    }
+
+                    updateInput(_sentence[posRndWindow]->index, *m_hiddenLayerErrors, _trainMatrix);
+                    continue;
+                }
+
                 // shift to the selected word vector in the matrix
                 auto shift = _sentence[posRndWindow]->index * m_sharedData.trainSettings->size;
 
@@ -209,6 +225,44 @@ namespace w2v {
         }
     }
 
+    inline void trainThread_t::addInput(std::size_t _index, std::vector<float> &_layer,
+                                        const std::vector<float> &_trainMatrix) noexcept {
+        auto size = m_sharedData.trainSettings->size;
+        if (!m_sharedData.subwords) {
+            for (std::size_t k = 0; k < size; ++k) {
+                _layer[k] += _trainMatrix[k + _index * size];
+            }
+            return;
+        }
+
+        // the mean of the word row and its n-gram bucket rows
+        auto const &rows = (*m_sharedData.subwords)[_index];
+        auto scale = 1.0f / rows.size();
+        for (auto row:rows) {
+            for (std::size_t k = 0; k < size; ++k) {
+                _layer[k] += _trainMatrix[k + row * size] * scale;
+            }
+        }
+    }
+
+    inline void trainThread_t::updateInput(std::size_t _index, const std::vector<float> &_errors,
+                                           std::vector<float> &_trainMatrix) noexcept {
+        auto size = m_sharedData.trainSettings->size;
+        if (!m_sharedData.subwords) {
+            for (std::size_t k = 0; k < size; ++k) {
+                _trainMatrix[k + _index * size] += _errors[k];
+            }
+            return;
+        }
+
+        // every row of the input vector learns the full error, the same as fastText
+        for (auto row:(*m_sharedData.subwords)[_index]) {
+            for (std::size_t k = 0; k < size; ++k) {
+                _trainMatrix[k + row * size] += _errors[k];
+            }
+        }
+    }
+
     inline void trainThread_t::hierarchicalSoftmax(std::size_t _index,
                                                    std::vector<float> &_hiddenLayer,
                                                    std::vector<float> &_trainLayer,
@@ -22,6 +22,7 @@
 #include "huffmanTree.hpp"
 #include "nsDistribution.hpp"
 #include "downSampling.hpp"
+#include "subwords.hpp"
 
 namespace w2v {
     /**
@@ -41,10 +42,11 @@ namespace w2v {
         struct sharedData_t final {
             std::shared_ptr<trainSettings_t> trainSettings; ///< trainSettings structure
             std::shared_ptr<vocabulary_t> vocabulary; ///< words data
-            std::shared_ptr<fileMapper_t> fileMapper; ///< train data file access object
+            std::shared_ptr<mapper_t> fileMapper; ///< train data file access object
             std::shared_ptr<std::vector<float>> bpWeights; ///< back propagation weights
             std::shared_ptr<std::vector<float>> expTable; ///< exp(x) / (exp(x) + 1) values lookup table
             std::shared_ptr<huffmanTree_t> huffmanTree; ///< Huffman tree used by hierarchical softmax
+            std::shared_ptr<std::vector<std::vector<std::size_t>>> subwords; ///< word and n-gram rows of each word
             std::shared_ptr<std::atomic<std::size_t>> processedWords; ///< total words processed by train threads
             std::shared_ptr<std::atomic<float>> alpha; ///< current learning rate
             std::function<void(float, float)> progressCallback = nullptr; ///< callback with alpha and training percent
@@ -60,7 +62,7 @@ namespace w2v {
         std::unique_ptr<nsDistribution_t> m_nsDistribution;
         std::unique_ptr<std::vector<float>> m_hiddenLayerVals;
         std::unique_ptr<std::vector<float>> m_hiddenLayerErrors;
-        std::unique_ptr<wordReader_t<fileMapper_t>> m_wordReader;
+        std::unique_ptr<wordReader_t<mapper_t>> m_wordReader;
         std::unique_ptr<std::thread> m_thread;
 
     public:
@@ -90,6 +92,10 @@ namespace w2v {
                          std::vector<float> &_trainMatrix) noexcept;
         inline void skipGram(const std::vector<const vocabulary_t::wordData_t *> &_sentence,
                              std::vector<float> &_trainMatrix) noexcept;
+        inline void addInput(std::size_t _index, std::vector<float> &_layer,
+                             const std::vector<float> &_trainMatrix) noexcept;
+        inline void updateInput(std::size_t _index, const std::vector<float> &_errors,
+                                std::vector<float> &_trainMatrix) noexcept;
         inline void  hierarchicalSoftmax(std::size_t _index,
                                          std::vector<float> &_hiddenLayer,
                                          std::vector<float> &_trainLayer, std::size_t _trainLayerShift) noexcept;
@@ -13,8 +13,9 @@
 namespace w2v {
     trainer_t::trainer_t(const std::shared_ptr<trainSettings_t> &_trainSettings,
                          const std::shared_ptr<vocabulary_t> &_vocabulary,
-                         const std::shared_ptr<fileMapper_t> &_fileMapper,
-                         std::function<void(float, float)> _progressCallback): m_threads() {
+                         const std::shared_ptr<mapper_t> &_fileMapper,
+                         std::function<void(float, float)> _progressCallback): m_bpWeights(), m_subwords(),
+                                                                               m_threads() {
         trainThread_t::sharedData_t sharedData;
 
         if (!_trainSettings) {
@@ -33,6 +34,7 @@ namespace w2v {
         sharedData.fileMapper = _fileMapper;
 
         sharedData.bpWeights.reset(new std::vector<float>(_trainSettings->size * _vocabulary->size(), 0.0f));
+        m_bpWeights = sharedData.bpWeights;
         sharedData.expTable.reset(new std::vector<float>(_trainSettings->expTableSize));
         for (uint16_t i = 0; i < _trainSettings->expTableSize; ++i) {
             // Precompute the exp() table
@@ -58,6 +60,29 @@ namespace w2v {
 
         m_matrixSize = sharedData.trainSettings->size * sharedData.vocabulary->size();
 
+        if (_trainSettings->minN > 0) {
+            subwords_t subwords(_trainSettings->minN, _trainSettings->maxN, _trainSettings->buckets);
+            if (!subwords.valid()) {
+                throw std::runtime_error("wrong character n-gram settings");
+            }
+
+            // n-gram bucket rows follow the word rows in the train matrix
+            std::vector<std::string> words;
+            _vocabulary->words(words);
+            m_subwords.reset(new std::vector<std::vector<std::size_t>>(words.size()));
+            for (std::size_t i = 0; i < words.size(); ++i) {
+                auto &rows = (*m_subwords)[i];
+                rows.push_back(i);
+                subwords.buckets(words[i], rows);
+                for (std::size_t j = 1; j < rows.size(); ++j) {
+                    rows[j] += words.size();
+                }
+            }
+            sharedData.subwords = m_subwords;
+
+            m_matrixSize += static_cast<std::size_t>(sharedData.trainSettings->size) * subwords.bucketsNumber();
+        }
+
         for (uint8_t i = 0; i < _trainSettings->threads; ++i) {
             m_threads.emplace_back(new trainThread_t(i, sharedData));
         }
@@ -73,6 +98,10 @@ namespace w2v {
             return rndMatrixInitializer(randomGenerator);
         });
 
+        resume(_trainMatrix);
+    }
+
+    void trainer_t::resume(std::vector<float> &_trainMatrix) noexcept {
         for (auto &i:m_threads) {
             i->launch(_trainMatrix);
         }
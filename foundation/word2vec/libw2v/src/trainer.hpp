@@ -28,6 +28,8 @@ namespace w2v {
     class trainer_t {
     private:
         std::size_t m_matrixSize = 0;
+        std::shared_ptr<std::vector<float>> m_bpWeights;
+        std::shared_ptr<std::vector<std::vector<std::size_t>>> m_subwords;
         std::vector<std::unique_ptr<trainThread_t>> m_threads;
 
     public:
@@ -40,14 +42,39 @@ namespace w2v {
         */
         trainer_t(const std::shared_ptr<trainSettings_t> &_trainSettings,
                   const std::shared_ptr<vocabulary_t> &_vocabulary,
-                  const std::shared_ptr<fileMapper_t> &_fileMapper,
+                  const std::shared_ptr<mapper_t> &_fileMapper,
                   std::function<void(float, float)> _progressCallback);
 
         /**
          * Runs training process
-         * @param[out] _trainMatrix train model matrix
+         * @param[out] _trainMatrix train model matrix, one row of vector size per vocabulary word followed by
+         * one row per character n-gram bucket when subword vectors are trained
         */
         void operator()(std::vector<float> &_trainMatrix) noexcept;
+
+        /**
+         * Runs training process starting from the values already in the train model matrix
+         * @param[in,out] _trainMatrix train model matrix, one row of vector size per vocabulary word
+        */
+        void resume(std::vector<float> &_trainMatrix) noexcept;
+
+        /// @returns back propagation weights, one row of vector size per vocabulary word with negative sampling
+        inline std::vector<float> &bpWeights() noexcept {
+            return *m_bpWeights;
+        }
+
+        /**
+         * Requests the train model matrix rows forming the input vector of a word
+         * @param _index word index
+         * @returns the word row followed by the rows of its character n-gram buckets, nullptr when subword
+         * vectors are not trained
+        */
+        inline const std::vector<std::size_t> *subwords(std::size_t _index) const noexcept {
+            if (!m_subwords) {
+                return nullptr;
+            }
+            return &(*m_subwords)[_index];
+        }
     };
 }
 
@@ -10,17 +10,18 @@
 #include "wordReader.hpp"
 
 namespace w2v {
-    vocabulary_t::vocabulary_t(std::shared_ptr<fileMapper_t> &_trainWordsMapper,
-                               std::shared_ptr<fileMapper_t> &_stopWordsMapper,
+    vocabulary_t::vocabulary_t(std::shared_ptr<mapper_t> &_trainWordsMapper,
+                               std::shared_ptr<mapper_t> &_stopWordsMapper,
                                const std::string &_wordDelimiterChars,
                                const std::string &_endOfSentenceChars,
                                uint16_t _minFreq,
                                w2vModel_t::vocabularyProgressCallback_t _progressCallback,
-                               w2vModel_t::vocabularyStatsCallback_t _statsCallback) noexcept: m_words() {
+                               w2vModel_t::vocabularyStatsCallback_t _statsCallback,
+                               const std::atomic<bool> *_stop) noexcept: m_words() {
         // load stop-words
         std::vector<std::string> stopWords;
         if (_stopWordsMapper) {
-            wordReader_t<fileMapper_t> wordReader(*_stopWordsMapper, _wordDelimiterChars, _endOfSentenceChars);
+            wordReader_t<mapper_t> wordReader(*_stopWordsMapper, _wordDelimiterChars, _endOfSentenceChars);
             std::string word;
             while (wordReader.nextWord(word)) {
                 stopWords.push_back(word);
@@ -35,9 +36,12 @@ namespace w2v {
         std::unordered_map<std::string, tmpWordData_t> tmpWords;
         off_t progressOffset = 0;
         if (_trainWordsMapper) {
-            wordReader_t<fileMapper_t> wordReader(*_trainWordsMapper, _wordDelimiterChars, _endOfSentenceChars);
+            wordReader_t<mapper_t> wordReader(*_trainWordsMapper, _wordDelimiterChars, _endOfSentenceChars);
             std::string word;
             while (wordReader.nextWord(word)) {
+                if (_stop != nullptr && *_stop) {
+                    return;
+                }
                 if (word.empty()) {
                     word = "</s>";
                 }
@@ -107,4 +111,42 @@ namespace w2v {
             _statsCallback(m_words.size(), m_trainWords, m_totalWords);
         }
     }
+
+    void vocabulary_t::extend(const std::vector<std::pair<std::string, std::size_t>> &_known,
+                              uint16_t _minFreq) noexcept {
+        wordMap_t words;
+        std::size_t index = 0;
+        m_trainWords = 0;
+
+        // known words keep their order, words missing from the parsed data keep their frequency
+        for (auto const &i:_known) {
+            std::size_t frequency = 0;
+            auto w = m_words.find(i.first);
+            if (w != m_words.end()) {
+                frequency = w->second.frequency;
+                if (i.first != "</s>") {
+                    m_trainWords += frequency;
+                }
+            }
+            words.emplace(i.first, wordData_t(index++, i.second + frequency));
+        }
+
+        // new words, from more frequent to less frequent
+        std::vector<std::pair<std::string, std::size_t>> newWords;
+        for (auto const &i:m_words) {
+            if (words.find(i.first) == words.end() && i.second.frequency >= _minFreq) {
+                newWords.emplace_back(std::pair<std::string, std::size_t>(i.first, i.second.frequency));
+            }
+        }
+        std::sort(newWords.begin(), newWords.end(), [](const std::pair<std::string, std::size_t> &_what,
+                                                       const std::pair<std::string, std::size_t> &_with) {
+            return _what.second > _with.second;
+        });
+        for (auto const &i:newWords) {
+            words.emplace(i.first, wordData_t(index++, i.second));
+            m_trainWords += i.second;
+        }
+
+        m_words = std::move(words);
+    }
 }
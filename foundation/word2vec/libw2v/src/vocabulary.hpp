@@ -60,14 +60,27 @@ namespace w2v {
          * @param _progressCallback callback function to be called on each new 0.01% processed train data
          * @param _statsCallback callback function to be called on train data loaded event to pass vocabulary size,
          * train words and total words amounts.
+         * @param _stop flag checked while parsing the train data, parsing stops once it's set.
+         * In case of nullptr, _stop will be ignored.
         */
-        vocabulary_t(std::shared_ptr<fileMapper_t> &_trainWordsMapper,
-                     std::shared_ptr<fileMapper_t> &_stopWordsMapper,
+        vocabulary_t(std::shared_ptr<mapper_t> &_trainWordsMapper,
+                     std::shared_ptr<mapper_t> &_stopWordsMapper,
                      const std::string &_wordDelimiterChars,
                      const std::string &_endOfSentenceChars,
                      uint16_t _minFreq,
                      w2vModel_t::vocabularyProgressCallback_t _progressCallback,
-                     w2vModel_t::vocabularyStatsCallback_t _statsCallback) noexcept;
+                     w2vModel_t::vocabularyStatsCallback_t _statsCallback,
+                     const std::atomic<bool> *_stop = nullptr) noexcept;
+
+        /**
+         * Extends the vocabulary of a trained model with the parsed words. The _known words come first in
+         * their order and their frequencies are added to the parsed ones. Other parsed words are appended,
+         * descending ordered by frequency, when their frequency is at least _minFreq, the rest are removed.
+         * The vocabulary should be parsed with a minimum frequency of 1 so no known word is lost.
+         * @param _known words of the trained model with their frequencies, descending ordered by frequency
+         * @param _minFreq minimum frequency of a new word
+        */
+        void extend(const std::vector<std::pair<std::string, std::size_t>> &_known, uint16_t _minFreq) noexcept;
 
         /**
          * Requests a data (index, frequency, word) associated with the _word
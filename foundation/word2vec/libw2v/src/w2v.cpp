@@ -2,11 +2,15 @@
 #include "word2vec.hpp"
 
 #include <inttypes.h>
+#include <atomic>
 #include <iostream>
 
 #include <iostream>
 #include <iomanip>
 #include <stdexcept>
+#include <cstring>
+#include <cmath>
+#include <cstdio>
 
 class H
 {
@@ -27,8 +31,55 @@ H::~H()
   model.reset();
 }
 
+// toVector copies the floats into a vector normalized the same way as the
+// word and document vectors, false is returned for a zero vector
+static bool toVector(const float *vector, uint16_t size, w2v::vector_t &vec)
+{
+  vec.assign(vector, vector + size);
+
+  float med = 0.0f;
+  for (auto const &i : vec)
+  {
+    med += i * i;
+  }
+  if (med <= 0.0f)
+  {
+    return false;
+  }
+  med = std::sqrt(med / vec.size());
+  for (auto &i : vec)
+  {
+    i /= med;
+  }
+
+  return true;
+}
+
+struct job_t
+{
+  std::atomic<bool> stop{false};
+};
+
+void *NewJob(void)
+{
+  return new job_t();
+}
+
+void CancelJob(void *job)
+{
+  reinterpret_cast<job_t *>(job)->stop = true;
+}
+
+void FreeJob(void *job)
+{
+  delete reinterpret_cast<job_t *>(job);
+}
+
 void *Train(
     char *fileTrain,
+    const char *trainData,
+    size_t trainSize,
+    char *fileBase,
     char *fileStopWords,
     char *fileModel,
     uint16_t minWordFreq,
@@ -41,9 +92,14 @@ void *Train(
     uint8_t iterations,
     float alpha,
     uint8_t withSG,
+    uint8_t minN,
+    uint8_t maxN,
+    uint32_t buckets,
     char *wordDelimiterChars,
     char *endOfSentenceChars,
-    uint8_t verbose)
+    uint8_t verbose,
+    void *job,
+    struct progress_t progress)
 {
   w2v::trainSettings_t trainSettings;
   trainSettings.size = vectorSize;
@@ -56,8 +112,15 @@ void *Train(
   trainSettings.minWordFreq = minWordFreq;
   trainSettings.alpha = alpha;
   trainSettings.withSG = withSG;
+  trainSettings.minN = minN;
+  trainSettings.maxN = maxN;
+  trainSettings.buckets = buckets;
   trainSettings.wordDelimiterChars = wordDelimiterChars;
   trainSettings.endOfSentenceChars = endOfSentenceChars;
+  if (job != nullptr)
+  {
+    trainSettings.stop = &reinterpret_cast<job_t *>(job)->stop;
+  }
 
   std::string trainFile;
   trainFile = fileTrain;
@@ -68,9 +131,23 @@ void *Train(
   std::string stopWordsFile;
   stopWordsFile = fileStopWords;
 
+  std::string baseFile;
+  baseFile = fileBase;
+
   if (verbose)
   {
-    std::cout << "Train data file: " << trainFile << std::endl;
+    if (trainData != nullptr)
+    {
+      std::cout << "Train data size: " << trainSize << " bytes" << std::endl;
+    }
+    else
+    {
+      std::cout << "Train data file: " << trainFile << std::endl;
+    }
+    if (!baseFile.empty())
+    {
+      std::cout << "Continue model file: " << baseFile << std::endl;
+    }
     std::cout << "Output model file: " << modelFile << std::endl;
     std::cout << "Stop-words file: " << stopWordsFile << std::endl;
     std::cout << "Training model: " << (trainSettings.withSG ? "Skip-Gram" : "CBOW") << std::endl;
@@ -84,6 +161,11 @@ void *Train(
       std::cout << "Negative sampling with number of negative examples = "
                 << static_cast<int>(trainSettings.negative) << std::endl;
     }
+    if (trainSettings.minN > 0)
+    {
+      std::cout << "Character n-grams: " << static_cast<int>(trainSettings.minN) << " to "
+                << static_cast<int>(trainSettings.maxN) << " in " << trainSettings.buckets << " buckets" << std::endl;
+    }
     std::cout << "Number of training threads: " << static_cast<int>(trainSettings.threads) << std::endl;
     std::cout << "Number of training iterations: " << static_cast<int>(trainSettings.iterations) << std::endl;
     std::cout << "Min word frequency: " << static_cast<int>(trainSettings.minWordFreq) << std::endl;
@@ -96,51 +178,137 @@ void *Train(
   }
 
   auto h = new H();
+  auto vocabularyProgress = [verbose, progress](float _percent)
+  {
+    if (verbose)
+    {
+      std::cout << "\rParsing train data... "
+                << std::fixed << std::setprecision(2)
+                << _percent << "%" << std::flush;
+    }
+    if (progress.parse != nullptr)
+    {
+      progress.parse(progress.handle, _percent);
+    }
+  };
+  auto vocabularyStats = [verbose, progress](std::size_t _vocWords, std::size_t _trainWords, std::size_t _totalWords)
+  {
+    if (verbose)
+    {
+      std::cout << std::endl
+                << "Vocabulary size: " << _vocWords << std::endl
+                << "Train words: " << _trainWords << std::endl
+                << "Total words: " << _totalWords << std::endl
+                << std::endl;
+    }
+    if (progress.stats != nullptr)
+    {
+      progress.stats(progress.handle, _vocWords, _trainWords, _totalWords);
+    }
+  };
+  auto trainProgress = [verbose, progress](float _alpha, float _percent)
+  {
+    if (verbose)
+    {
+      std::cout << "\r                                                                  \r"
+                << "alpha: "
+                << std::fixed << std::setprecision(6)
+                << _alpha
+                << ", progress: "
+                << std::fixed << std::setprecision(2)
+                << _percent << "%"
+                << std::flush;
+    }
+    if (progress.train != nullptr)
+    {
+      progress.train(progress.handle, _alpha, _percent);
+    }
+  };
+
+  if (!baseFile.empty() && !h->model->resume(baseFile))
+  {
+    std::cerr << "Model file loading failed: " << h->model->errMsg() << std::endl;
+    delete h;
+    return 0;
+  }
+
   bool trained;
-  if (verbose)
+  if (trainData != nullptr)
   {
-    trained = h->model->train(
-        trainSettings, trainFile, stopWordsFile,
-        [](float _percent)
-        {
-          std::cout << "\rParsing train data... "
-                    << std::fixed << std::setprecision(2)
-                    << _percent << "%" << std::flush;
-        },
-        [](std::size_t _vocWords, std::size_t _trainWords, std::size_t _totalWords)
-        {
-          std::cout << std::endl
-                    << "Vocabulary size: " << _vocWords << std::endl
-                    << "Train words: " << _trainWords << std::endl
-                    << "Total words: " << _totalWords << std::endl
-                    << std::endl;
-        },
-        [](float _alpha, float _percent)
-        {
-          std::cout << "\r                                                                  \r"
-                    << "alpha: "
-                    << std::fixed << std::setprecision(6)
-                    << _alpha
-                    << ", progress: "
-                    << std::fixed << std::setprecision(2)
-                    << _percent << "%"
-                    << std::flush;
-        });
-    std::cout << std::endl;
+    trained = h->model->train(trainSettings, trainData, trainSize, stopWordsFile,
+                              vocabularyProgress, vocabularyStats, trainProgress);
   }
   else
   {
-    trained = h->model->train(trainSettings, trainFile, stopWordsFile, nullptr, nullptr, nullptr);
+    trained = h->model->train(trainSettings, trainFile, stopWordsFile,
+                              vocabularyProgress, vocabularyStats, trainProgress);
+  }
+  if (verbose)
+  {
+    std::cout << std::endl;
   }
   if (!trained)
   {
-    std::cerr << "Training failed: " << h->model->errMsg() << std::endl;
+    // a cancelled job fails training too, it's reported to the caller and not printed unless verbose
+    if (verbose)
+    {
+      std::cerr << "Training failed: " << h->model->errMsg() << std::endl;
+    }
+    delete h;
     return 0;
   }
 
   if (!h->model->save(modelFile))
   {
     std::cerr << "Model file saving failed: " << h->model->errMsg() << std::endl;
+    delete h;
+    return 0;
+  }
+
+  if (!h->model->saveVocab(modelFile + ".vocab"))
+  {
+    std::cerr << "Vocabulary file saving failed: " << h->model->errMsg() << std::endl;
+    delete h;
+    return 0;
+  }
+
+  // output weights are needed to continue training, a stale file from an earlier run is removed
+  auto weightsFile = modelFile + ".weights";
+  if (h->model->hasWeights())
+  {
+    if (!h->model->saveWeights(weightsFile))
+    {
+      std::cerr << "Weights file saving failed: " << h->model->errMsg() << std::endl;
+      delete h;
+      return 0;
+    }
+  }
+  else
+  {
+    std::remove(weightsFile.c_str());
+  }
+
+  // character n-gram vectors compose unknown words, a stale file from an earlier run is removed
+  auto subwordsFile = modelFile + ".subwords";
+  if (h->model->hasSubwords())
+  {
+    if (!h->model->saveSubwords(subwordsFile))
+    {
+      std::cerr << "Subwords file saving failed: " << h->model->errMsg() << std::endl;
+      delete h;
+      return 0;
+    }
+  }
+  else
+  {
+    std::remove(subwordsFile.c_str());
+  }
+
+  // the trained vectors are not normalized, reload them the same way Load does
+  if (!h->model->load(modelFile) || !h->model->loadSubwords(subwordsFile))
+  {
+    std::cerr << "Model file loading failed: " << h->model->errMsg() << std::endl;
+    delete h;
     return 0;
   }
 
@@ -155,6 +323,18 @@ void *Load(const char *file)
   if (!h->model->load(file))
   {
     std::cerr << h->model->errMsg() << '\n';
+    delete h;
+    return 0;
+  }
+
+  // the vocabulary file is optional, models trained elsewhere don't have one
+  h->model->loadVocab(std::string(file) + ".vocab");
+
+  // so is the subwords file, but a broken one fails the load
+  if (!h->model->loadSubwords(std::string(file) + ".subwords"))
+  {
+    std::cerr << h->model->errMsg() << '\n';
+    delete h;
     return 0;
   }
 
@@ -167,12 +347,64 @@ void Free(void *fd)
   delete h;
 }
 
+uint16_t VectorSize(void *fd)
+{
+  auto h = reinterpret_cast<H *>(fd);
+  return h->model->vectorSize();
+}
+
+size_t ModelSize(void *fd)
+{
+  auto h = reinterpret_cast<H *>(fd);
+  return h->model->map().size();
+}
+
+size_t Frequency(void *fd, const char *word)
+{
+  auto h = reinterpret_cast<H *>(fd);
+  return h->model->frequency(word);
+}
+
+struct words_t Words(void *fd)
+{
+  try
+  {
+    auto h = reinterpret_cast<H *>(fd);
+    auto const &m = h->model->map();
+
+    size_t len = 0;
+    for (auto const &i : m)
+    {
+      len += i.first.length() + 1;
+    }
+
+    char *buf = (char *)malloc(len);
+
+    size_t p = 0;
+    for (auto const &i : m)
+    {
+      std::memcpy(buf + p, i.first.c_str(), i.first.length() + 1);
+      p += i.first.length() + 1;
+    }
+
+    return words_t{buf, len, m.size()};
+  }
+  catch (const std::exception &e)
+  {
+    return words_t{0, 0, 0};
+  }
+}
+
 float *VectorOf(void *fd, const char *word)
 {
   try
   {
     auto h = reinterpret_cast<H *>(fd);
-    w2v::word2vec_t vec(h->model, word);
+    w2v::vector_t vec;
+    if (!h->model->wordVector(word, vec))
+    {
+      return 0;
+    }
 
     float *vector = (float *)malloc(sizeof(float) * vec.size());
     std::copy(vec.begin(), vec.end(), vector);
@@ -185,12 +417,24 @@ float *VectorOf(void *fd, const char *word)
   }
 }
 
-float *Embedding(void *fd, const char *doc)
+// toDoc2vec splits the document with the delimiters when they are set
+static w2v::doc2vec_t toDoc2vec(const std::unique_ptr<w2v::w2vModel_t> &model, const char *doc,
+                                const char *wordDelimiterChars)
+{
+  if (wordDelimiterChars == nullptr)
+  {
+    return w2v::doc2vec_t(model, doc);
+  }
+
+  return w2v::doc2vec_t(model, doc, wordDelimiterChars);
+}
+
+float *Embedding(void *fd, const char *doc, const char *wordDelimiterChars)
 {
   try
   {
     auto h = reinterpret_cast<H *>(fd);
-    w2v::doc2vec_t vec(h->model, doc);
+    auto vec = toDoc2vec(h->model, doc, wordDelimiterChars);
 
     float *vector = (float *)malloc(sizeof(float) * vec.size());
     std::copy(vec.begin(), vec.end(), vector);
@@ -203,42 +447,207 @@ float *Embedding(void *fd, const char *doc)
   }
 }
 
-struct nearest_t Lookup(void *fd, const char *query, size_t k)
+// toNearest copies the nearest words into the memory returned to the caller
+static struct nearest_t toNearest(const std::vector<std::pair<std::string, float>> &nearests)
+{
+  auto n = nearests.size();
+
+  float *seqd = (float *)malloc(sizeof(float) * (n + 1));
+
+  size_t len = 0;
+  for (auto i = size_t(0); i < n; i++)
+  {
+    len += nearests[i].first.length() + 1;
+  }
+  char *seqw = (char *)malloc(len + 1);
+
+  size_t p = 0;
+
+  for (auto i = size_t(0); i < n; i++)
+  {
+    *(seqd + i) = nearests[i].second;
+
+    strcpy(seqw + p, nearests[i].first.c_str());
+
+    p += nearests[i].first.length();
+    *(seqw + p) = '\0';
+
+    p++;
+  }
+  return nearest_t{seqd, len, seqw, n};
+}
+
+struct nearest_t Lookup(void *fd, const char *query, size_t k, const char *wordDelimiterChars)
 {
   try
   {
     auto h = reinterpret_cast<H *>(fd);
-    w2v::doc2vec_t vec(h->model, query);
+    auto vec = toDoc2vec(h->model, query, wordDelimiterChars);
 
+    // the model can have fewer than k neighbours
     std::vector<std::pair<std::string, float>> nearests;
     h->model->nearest(vec, nearests, k);
 
-    float *seqd = (float *)malloc(sizeof(float) * k);
+    return toNearest(nearests);
+  }
+  catch (const std::exception &e)
+  {
+    return nearest_t{0, 0, 0, 0};
+  }
+}
 
-    size_t len = 0;
-    for (auto i = size_t(0); i < k; i++)
+struct nearest_t LookupVector(void *fd, const float *vector, size_t k)
+{
+  try
+  {
+    auto h = reinterpret_cast<H *>(fd);
+
+    w2v::vector_t vec;
+    if (!toVector(vector, h->model->vectorSize(), vec))
     {
-      len += nearests[i].first.length() + 1;
+      return nearest_t{0, 0, 0, 0};
     }
-    char *seqw = (char *)malloc(len);
 
-    size_t p = 0;
+    std::vector<std::pair<std::string, float>> nearests;
+    h->model->nearest(vec, nearests, k);
+
+    return toNearest(nearests);
+  }
+  catch (const std::exception &e)
+  {
+    return nearest_t{0, 0, 0, 0};
+  }
+}
+
+// Document models
+
+class D
+{
+public:
+  std::unique_ptr<w2v::d2vModel_t> model;
+
+  D(uint16_t vectorSize);
+  ~D();
+};
+
+D::D(uint16_t vectorSize)
+{
+  model.reset(new w2v::d2vModel_t(vectorSize));
+}
+
+D::~D()
+{
+  model.reset();
+}
+
+void *NewDocModel(uint16_t vectorSize)
+{
+  return new D(vectorSize);
+}
+
+void *LoadDocModel(const char *file)
+{
+  auto d = new D(0);
+
+  if (!d->model->load(file))
+  {
+    std::cerr << d->model->errMsg() << '\n';
+    delete d;
+    return 0;
+  }
+
+  return d;
+}
+
+uint8_t SaveDocModel(void *fd, const char *file)
+{
+  auto d = reinterpret_cast<D *>(fd);
+
+  if (!d->model->save(file))
+  {
+    std::cerr << d->model->errMsg() << '\n';
+    return 0;
+  }
+
+  return 1;
+}
 
-    for (auto i = size_t(0); i < k; i++)
+void FreeDocModel(void *fd)
+{
+  auto d = reinterpret_cast<D *>(fd);
+  delete d;
+}
+
+uint16_t DocVectorSize(void *fd)
+{
+  auto d = reinterpret_cast<D *>(fd);
+  return d->model->vectorSize();
+}
+
+size_t DocModelSize(void *fd)
+{
+  auto d = reinterpret_cast<D *>(fd);
+  return d->model->modelSize();
+}
+
+uint8_t DocSet(void *fd, size_t id, const float *vector)
+{
+  try
+  {
+    auto d = reinterpret_cast<D *>(fd);
+
+    w2v::vector_t vec;
+    if (!toVector(vector, d->model->vectorSize(), vec))
     {
-      *(seqd + i) = nearests[i].second;
+      return 0;
+    }
 
-      strcpy(seqw + p, nearests[i].first.c_str());
+    d->model->set(id, vec);
 
-      p += nearests[i].first.length();
-      *(seqw + p) = '\0';
+    return 1;
+  }
+  catch (const std::exception &e)
+  {
+    return 0;
+  }
+}
 
-      p++;
+void DocErase(void *fd, size_t id)
+{
+  auto d = reinterpret_cast<D *>(fd);
+  d->model->erase(id);
+}
+
+struct docNearest_t DocLookup(void *fd, const float *vector, size_t k)
+{
+  try
+  {
+    auto d = reinterpret_cast<D *>(fd);
+
+    w2v::vector_t vec;
+    if (!toVector(vector, d->model->vectorSize(), vec))
+    {
+      return docNearest_t{0, 0, 0};
+    }
+
+    std::vector<std::pair<std::size_t, float>> nearests;
+    d->model->nearest(vec, nearests, k);
+
+    auto n = nearests.size();
+
+    size_t *ids = (size_t *)malloc(sizeof(size_t) * (n + 1));
+    float *seqd = (float *)malloc(sizeof(float) * (n + 1));
+
+    for (auto i = size_t(0); i < n; i++)
+    {
+      *(ids + i) = nearests[i].first;
+      *(seqd + i) = nearests[i].second;
     }
-    return nearest_t{seqd, len, seqw};
+
+    return docNearest_t{ids, seqd, n};
   }
   catch (const std::exception &e)
   {
-    return nearest_t{0, 0, 0};
+    return docNearest_t{0, 0, 0};
   }
 }
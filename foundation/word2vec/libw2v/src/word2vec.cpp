@@ -7,11 +7,15 @@
  */
 
 #include <stdexcept>
+#include <fstream>
+#include <algorithm>
+#include <random>
 
 #include "word2vec.hpp"
 #include "wordReader.hpp"
 #include "vocabulary.hpp"
 #include "trainer.hpp"
+#include "subwords.hpp"
 
 namespace w2v
 {
@@ -20,7 +24,7 @@ namespace w2v
     //
     //
 
-    w2vModel_t::w2vModel_t() : model_t<std::string>() {}
+    w2vModel_t::w2vModel_t() : model_t<std::string>(), m_frequencies(), m_weights(), m_subwords(), m_ngramVectors() {}
 
     bool w2vModel_t::train(const trainSettings_t &_trainSettings,
                            const std::string &_trainFile,
@@ -32,45 +36,258 @@ namespace w2v
         try
         {
             // map train data set file to memory
-            std::shared_ptr<fileMapper_t> trainWordsMapper(new fileMapper_t(_trainFile));
-            // map stop-words file to memory
-            std::shared_ptr<fileMapper_t> stopWordsMapper;
-            if (!_stopWordsFile.empty())
-            {
-                stopWordsMapper.reset(new fileMapper_t(_stopWordsFile));
-            }
-
-            // build vocabulary, skip stop-words and words with frequency < minWordFreq
-            std::shared_ptr<vocabulary_t> vocabulary(new vocabulary_t(trainWordsMapper,
-                                                                      stopWordsMapper,
-                                                                      _trainSettings.wordDelimiterChars,
-                                                                      _trainSettings.endOfSentenceChars,
-                                                                      _trainSettings.minWordFreq,
-                                                                      _vocabularyProgressCallback,
-                                                                      _vocabularyStatsCallback));
-            // key words descending ordered by their indexes
-            std::vector<std::string> words;
-            vocabulary->words(words);
-            m_vectorSize = _trainSettings.size;
-            m_mapSize = vocabulary->size();
-
-            // train model
-            std::vector<float> _trainMatrix;
-            trainer_t(std::make_shared<trainSettings_t>(_trainSettings),
-                      vocabulary,
-                      trainWordsMapper,
-                      _trainProgressCallback)(_trainMatrix);
+            std::shared_ptr<mapper_t> trainWordsMapper(new fileMapper_t(_trainFile));
+
+            train(_trainSettings, trainWordsMapper, _stopWordsFile,
+                  _vocabularyProgressCallback, _vocabularyStatsCallback, _trainProgressCallback);
+
+            return true;
+        }
+        catch (const std::exception &_e)
+        {
+            m_errMsg = _e.what();
+        }
+        catch (...)
+        {
+            m_errMsg = "unknown error";
+        }
+
+        return false;
+    }
+
+    bool w2vModel_t::train(const trainSettings_t &_trainSettings,
+                           const char *_trainData,
+                           std::size_t _trainSize,
+                           const std::string &_stopWordsFile,
+                           vocabularyProgressCallback_t _vocabularyProgressCallback,
+                           vocabularyStatsCallback_t _vocabularyStatsCallback,
+                           trainProgressCallback_t _trainProgressCallback) noexcept
+    {
+        try
+        {
+            if (_trainData == nullptr || _trainSize == 0)
+            {
+                throw std::runtime_error("train data is empty");
+            }
+
+            // train data is already in memory
+            std::shared_ptr<mapper_t> trainWordsMapper(new mapper_t(_trainData, static_cast<off_t>(_trainSize)));
+
+            train(_trainSettings, trainWordsMapper, _stopWordsFile,
+                  _vocabularyProgressCallback, _vocabularyStatsCallback, _trainProgressCallback);
+
+            return true;
+        }
+        catch (const std::exception &_e)
+        {
+            m_errMsg = _e.what();
+        }
+        catch (...)
+        {
+            m_errMsg = "unknown error";
+        }
+
+        return false;
+    }
+
+    void w2vModel_t::train(const trainSettings_t &_trainSettings,
+                           std::shared_ptr<mapper_t> &_trainWordsMapper,
+                           const std::string &_stopWordsFile,
+                           vocabularyProgressCallback_t _vocabularyProgressCallback,
+                           vocabularyStatsCallback_t _vocabularyStatsCallback,
+                           trainProgressCallback_t _trainProgressCallback)
+    {
+        auto trainSettings = std::make_shared<trainSettings_t>(_trainSettings);
+        bool resuming = m_resumable;
+        m_resumable = false;
+        if (resuming)
+        {
+            if (trainSettings->withHS)
+            {
+                throw std::runtime_error("continued training supports negative sampling only");
+            }
+            if (trainSettings->minN > 0)
+            {
+                throw std::runtime_error("continued training does not support subword vectors");
+            }
+            // vectors of the resumed model keep their size
+            trainSettings->size = m_vectorSize;
+        }
+
+        // map stop-words file to memory
+        std::shared_ptr<mapper_t> stopWordsMapper;
+        if (!_stopWordsFile.empty())
+        {
+            stopWordsMapper.reset(new fileMapper_t(_stopWordsFile));
+        }
+
+        // build vocabulary, skip stop-words and words with frequency < minWordFreq,
+        // known words of a resumed model are kept whatever their frequency
+        std::shared_ptr<vocabulary_t> vocabulary(new vocabulary_t(_trainWordsMapper,
+                                                                  stopWordsMapper,
+                                                                  trainSettings->wordDelimiterChars,
+                                                                  trainSettings->endOfSentenceChars,
+                                                                  resuming ? 1 : trainSettings->minWordFreq,
+                                                                  _vocabularyProgressCallback,
+                                                                  resuming ? nullptr : _vocabularyStatsCallback,
+                                                                  trainSettings->stop));
+        if (trainSettings->stop != nullptr && *trainSettings->stop)
+        {
+            throw std::runtime_error("training cancelled");
+        }
+        if (resuming)
+        {
+            std::vector<std::pair<std::string, std::size_t>> known;
+            for (auto const &i : m_map)
+            {
+                known.emplace_back(std::pair<std::string, std::size_t>(i.first, frequency(i.first)));
+            }
+            std::sort(known.begin(), known.end(),
+                      [](const std::pair<std::string, std::size_t> &_left,
+                         const std::pair<std::string, std::size_t> &_right)
+                      {
+                          if (_left.second != _right.second)
+                          {
+                              return _left.second > _right.second;
+                          }
+                          return _left.first < _right.first;
+                      });
+            vocabulary->extend(known, trainSettings->minWordFreq);
+
+            if (_vocabularyStatsCallback != nullptr)
+            {
+                _vocabularyStatsCallback(vocabulary->size(), vocabulary->trainWords(), vocabulary->totalWords());
+            }
+        }
+        // key words descending ordered by their indexes
+        std::vector<std::string> words;
+        vocabulary->words(words);
+        m_vectorSize = trainSettings->size;
+        m_mapSize = vocabulary->size();
+
+        // train model
+        std::vector<float> _trainMatrix;
+        trainer_t trainer(trainSettings,
+                          vocabulary,
+                          _trainWordsMapper,
+                          _trainProgressCallback);
+        if (resuming)
+        {
+            // known words start from their trained vectors and output weights,
+            // new words from small random values like a new model
+            std::random_device randomDevice;
+            std::mt19937_64 randomGenerator(randomDevice());
+            std::uniform_real_distribution<float> rndMatrixInitializer(-0.005f, 0.005f);
+            _trainMatrix.resize(m_vectorSize * words.size());
+            auto &bpWeights = trainer.bpWeights();
 
             std::size_t wordIndex = 0;
             for (auto const &i : words)
             {
-                auto &v = m_map[i];
-                v.resize(m_vectorSize);
+                auto row = &_trainMatrix[wordIndex * m_vectorSize];
+                auto v = m_map.find(i);
+                if (v != m_map.end())
+                {
+                    std::copy(v->second.begin(), v->second.end(), row);
+                }
+                else
+                {
+                    std::generate(row, row + m_vectorSize, [&]()
+                                  { return rndMatrixInitializer(randomGenerator); });
+                }
+
+                auto w = m_weights.find(i);
+                if (w != m_weights.end())
+                {
+                    std::copy(w->second.begin(), w->second.end(), &bpWeights[wordIndex * m_vectorSize]);
+                }
+                wordIndex++;
+            }
+
+            trainer.resume(_trainMatrix);
+        }
+        else
+        {
+            trainer(_trainMatrix);
+        }
+        if (trainSettings->stop != nullptr && *trainSettings->stop)
+        {
+            throw std::runtime_error("training cancelled");
+        }
+
+        m_frequencies.clear();
+        for (auto const &i : words)
+        {
+            auto data = vocabulary->data(i);
+            if (data != nullptr)
+            {
+                m_frequencies[i] = data->frequency;
+            }
+        }
+
+        m_map.clear();
+        m_weights.clear();
+        m_ngramVectors.clear();
+        m_subwords.reset();
+        if (trainSettings->minN > 0)
+        {
+            m_subwords = std::make_shared<subwords_t>(trainSettings->minN, trainSettings->maxN,
+                                                      trainSettings->buckets);
+        }
+        auto &bpWeights = trainer.bpWeights();
+        std::size_t wordIndex = 0;
+        for (auto const &i : words)
+        {
+            auto &v = m_map[i];
+            v.resize(m_vectorSize);
+            auto rows = trainer.subwords(wordIndex);
+            if (rows == nullptr)
+            {
                 std::copy(&_trainMatrix[wordIndex * m_vectorSize],
                           &_trainMatrix[(wordIndex + 1) * m_vectorSize],
                           &v[0]);
-                wordIndex++;
             }
+            else
+            {
+                // the word vector is the mean of the word row and its n-gram rows, as used in training,
+                // the n-gram rows are kept to compose vectors of unknown words
+                for (auto row : *rows)
+                {
+                    auto from = &_trainMatrix[row * m_vectorSize];
+                    for (uint16_t k = 0; k < m_vectorSize; ++k)
+                    {
+                        v[k] += from[k] / rows->size();
+                    }
+                    if (row < words.size())
+                    {
+                        continue;
+                    }
+                    auto &n = m_ngramVectors[row - words.size()];
+                    if (n.empty())
+                    {
+                        n.assign(from, from + m_vectorSize);
+                    }
+                }
+            }
+
+            // with hierarchical softmax the weights belong to the Huffman tree nodes, not to words
+            if (!trainSettings->withHS)
+            {
+                auto &w = m_weights[i];
+                w.resize(m_vectorSize);
+                std::copy(&bpWeights[wordIndex * m_vectorSize],
+                          &bpWeights[(wordIndex + 1) * m_vectorSize],
+                          &w[0]);
+            }
+            wordIndex++;
+        }
+    }
+
+    bool w2vModel_t::save(const std::string &_modelFile) const noexcept
+    {
+        try
+        {
+            writeVectors(_modelFile, m_map, m_vectorSize);
 
             return true;
         }
@@ -86,46 +303,160 @@ namespace w2v
         return false;
     }
 
-    bool w2vModel_t::save(const std::string &_modelFile) const noexcept
+    bool w2vModel_t::saveWeights(const std::string &_weightsFile) const noexcept
     {
         try
         {
-            // save trained data in original word2vec format
-            // file header
-            std::string fileHeader = std::to_string(m_mapSize) + " " + std::to_string(m_vectorSize) + "\n";
-            // calc output size
-            // header size
-            auto outputSize = static_cast<off_t>(fileHeader.length() * sizeof(char));
-            for (auto const &i : m_map)
+            writeVectors(_weightsFile, m_weights, m_vectorSize);
+
+            return true;
+        }
+        catch (const std::exception &_e)
+        {
+            m_errMsg = _e.what();
+        }
+        catch (...)
+        {
+            m_errMsg = "unknown error";
+        }
+
+        return false;
+    }
+
+    void w2vModel_t::writeVectors(const std::string &_file, const map_t &_map, uint16_t _vectorSize)
+    {
+        // save trained data in original word2vec format
+        // file header
+        std::string fileHeader = std::to_string(_map.size()) + " " + std::to_string(_vectorSize) + "\n";
+        // calc output size
+        // header size
+        auto outputSize = static_cast<off_t>(fileHeader.length() * sizeof(char));
+        for (auto const &i : _map)
+        {
+            // size of (word + space char + vector size + size of cartridge return char)
+            outputSize += (i.first.length() + 2) * sizeof(char) + _vectorSize * sizeof(float);
+        }
+        // write data to the file
+        fileMapper_t output(_file, true, outputSize);
+        char sp = ' ';
+        char cr = '\n';
+        off_t offset = 0;
+        // write file header
+        std::memcpy(reinterpret_cast<void *>(output.data() + offset),
+                    fileHeader.data(), fileHeader.length() * sizeof(char));
+        offset += fileHeader.length() * sizeof(char);
+
+        // write words and their vectors
+        for (auto const &i : _map)
+        {
+            std::memcpy(reinterpret_cast<void *>(output.data() + offset),
+                        i.first.data(), i.first.length() * sizeof(char));
+            offset += i.first.length() * sizeof(char);
+            std::memcpy(reinterpret_cast<void *>(output.data() + offset), &sp, sizeof(char));
+            offset += sizeof(char);
+
+            auto shift = _vectorSize * sizeof(float);
+            std::memcpy(reinterpret_cast<void *>(output.data() + offset), i.second.data(), shift);
+            offset += shift;
+
+            std::memcpy(reinterpret_cast<void *>(output.data() + offset), &cr, sizeof(char));
+            offset += sizeof(char);
+        }
+    }
+
+    bool w2vModel_t::wordVector(const std::string &_word, vector_t &_vector) const noexcept
+    {
+        try
+        {
+            auto known = vector(_word);
+            if (known != nullptr)
             {
-                // size of (word + space char + vector size + size of cartridge return char)
-                outputSize += (i.first.length() + 2) * sizeof(char) + m_vectorSize * sizeof(float);
+                _vector = *known;
+                return true;
             }
-            // write data to the file
-            fileMapper_t output(_modelFile, true, outputSize);
-            char sp = ' ';
-            char cr = '\n';
-            off_t offset = 0;
-            // write file header
-            std::memcpy(reinterpret_cast<void *>(output.data() + offset),
-                        fileHeader.data(), fileHeader.length() * sizeof(char));
-            offset += fileHeader.length() * sizeof(char);
 
-            // write words and their vectors
-            for (auto const &i : m_map)
+            if (!m_subwords)
             {
-                std::memcpy(reinterpret_cast<void *>(output.data() + offset),
-                            i.first.data(), i.first.length() * sizeof(char));
-                offset += i.first.length() * sizeof(char);
-                std::memcpy(reinterpret_cast<void *>(output.data() + offset), &sp, sizeof(char));
-                offset += sizeof(char);
+                return false;
+            }
+
+            std::vector<std::size_t> buckets;
+            m_subwords->buckets(_word, buckets);
 
-                auto shift = m_vectorSize * sizeof(float);
-                std::memcpy(reinterpret_cast<void *>(output.data() + offset), i.second.data(), shift);
-                offset += shift;
+            _vector.assign(m_vectorSize, 0.0f);
+            bool found = false;
+            for (auto const &i : buckets)
+            {
+                // buckets not used by the vocabulary were never trained
+                auto n = m_ngramVectors.find(i);
+                if (n == m_ngramVectors.end())
+                {
+                    continue;
+                }
+                for (uint16_t k = 0; k < m_vectorSize; ++k)
+                {
+                    _vector[k] += n->second[k];
+                }
+                found = true;
+            }
+            if (!found)
+            {
+                return false;
+            }
 
-                std::memcpy(reinterpret_cast<void *>(output.data() + offset), &cr, sizeof(char));
-                offset += sizeof(char);
+            float med = 0.0f;
+            for (auto const &i : _vector)
+            {
+                med += i * i;
+            }
+            if (med <= 0.0f)
+            {
+                return false;
+            }
+            med = std::sqrt(med / _vector.size());
+            for (auto &i : _vector)
+            {
+                i /= med;
+            }
+
+            return true;
+        }
+        catch (...)
+        {
+            return false;
+        }
+    }
+
+    bool w2vModel_t::saveSubwords(const std::string &_subwordsFile) const noexcept
+    {
+        try
+        {
+            if (!m_subwords)
+            {
+                throw std::runtime_error("subwords: model has no subword vectors");
+            }
+
+            std::ofstream output(_subwordsFile, std::ios::out | std::ios::trunc | std::ios::binary);
+            if (!output)
+            {
+                throw std::runtime_error("subwords: can not create file " + _subwordsFile);
+            }
+
+            // "vectors size minN maxN buckets" header, then bucket index, space, raw vector and new line
+            output << m_ngramVectors.size() << ' ' << m_vectorSize << ' '
+                   << static_cast<int>(m_subwords->minN()) << ' ' << static_cast<int>(m_subwords->maxN()) << ' '
+                   << m_subwords->bucketsNumber() << '\n';
+            for (auto const &i : m_ngramVectors)
+            {
+                output << i.first << ' ';
+                output.write(reinterpret_cast<const char *>(i.second.data()), m_vectorSize * sizeof(float));
+                output << '\n';
+            }
+
+            output.close();
+            if (!output)
+            {
+                throw std::runtime_error("subwords: can not write file " + _subwordsFile);
             }
 
             return true;
@@ -142,100 +473,219 @@ namespace w2v
         return false;
     }
 
-    bool w2vModel_t::load(const std::string &_modelFile) noexcept
+    bool w2vModel_t::loadSubwords(const std::string &_subwordsFile) noexcept
     {
         try
         {
-            m_map.clear();
+            m_subwords.reset();
+            m_ngramVectors.clear();
 
-            // map model file, exception will be thrown on empty file
-            fileMapper_t input(_modelFile);
+            std::ifstream input(_subwordsFile, std::ios::in | std::ios::binary);
+            if (!input)
+            {
+                return true;
+            }
 
-            // parse header
-            off_t offset = 0;
-            // get words number
-            std::string nwStr;
-            char ch = 0;
-            while ((ch = (*(input.data() + offset))) != ' ')
+            const std::string errMsg = "subwords: wrong file format";
+
+            std::size_t vectors = 0;
+            std::size_t vectorSize = 0;
+            int minN = 0;
+            int maxN = 0;
+            uint32_t buckets = 0;
+            if (!(input >> vectors >> vectorSize >> minN >> maxN >> buckets) || input.get() != '\n')
             {
-                nwStr += ch;
-                if (++offset >= input.size())
-                {
-                    throw std::runtime_error(wrongFormatErrMsg);
-                }
+                throw std::runtime_error(errMsg);
+            }
+            if (vectorSize != m_vectorSize || minN < 0 || maxN > 0xFF)
+            {
+                throw std::runtime_error(errMsg);
+            }
+            auto subwords = std::make_shared<subwords_t>(static_cast<uint8_t>(minN), static_cast<uint8_t>(maxN),
+                                                         buckets);
+            if (!subwords->valid())
+            {
+                throw std::runtime_error(errMsg);
             }
 
-            // get vector size
-            offset++; // skip ' ' char
-            std::string vsStr;
-            while ((ch = (*(input.data() + offset))) != '\n')
+            for (std::size_t i = 0; i < vectors; ++i)
             {
-                vsStr += ch;
-                if (++offset >= input.size())
+                std::size_t bucket = 0;
+                if (!(input >> bucket) || input.get() != ' ' || bucket >= buckets)
                 {
-                    throw std::runtime_error(wrongFormatErrMsg);
+                    throw std::runtime_error(errMsg);
+                }
+
+                auto &v = m_ngramVectors[bucket];
+                v.resize(m_vectorSize);
+                if (!input.read(reinterpret_cast<char *>(v.data()), m_vectorSize * sizeof(float))
+                    || input.get() != '\n')
+                {
+                    throw std::runtime_error(errMsg);
                 }
             }
 
-            try
+            m_subwords = subwords;
+
+            return true;
+        }
+        catch (const std::exception &_e)
+        {
+            m_errMsg = _e.what();
+        }
+        catch (...)
+        {
+            m_errMsg = "unknown error";
+        }
+
+        m_subwords.reset();
+        m_ngramVectors.clear();
+
+        return false;
+    }
+
+    bool w2vModel_t::saveVocab(const std::string &_vocabFile) const noexcept
+    {
+        try
+        {
+            // most frequent words first, the same order as the original word2vec vocabulary file
+            std::vector<std::pair<std::string, std::size_t>> words(m_frequencies.begin(), m_frequencies.end());
+            std::sort(words.begin(), words.end(),
+                      [](const std::pair<std::string, std::size_t> &_left,
+                         const std::pair<std::string, std::size_t> &_right)
+                      {
+                          if (_left.second != _right.second)
+                          {
+                              return _left.second > _right.second;
+                          }
+                          return _left.first < _right.first;
+                      });
+
+            std::ofstream output(_vocabFile, std::ios::out | std::ios::trunc);
+            if (!output)
             {
-                m_mapSize = static_cast<std::size_t>(std::stoll(nwStr));
-                m_vectorSize = static_cast<uint16_t>(std::stoi(vsStr));
+                throw std::runtime_error("vocabulary: can not create file " + _vocabFile);
             }
-            catch (...)
+
+            for (auto const &i : words)
             {
-                throw std::runtime_error(wrongFormatErrMsg);
+                output << i.first << ' ' << i.second << '\n';
+            }
+
+            output.close();
+            if (!output)
+            {
+                throw std::runtime_error("vocabulary: can not write file " + _vocabFile);
+            }
+
+            return true;
+        }
+        catch (const std::exception &_e)
+        {
+            m_errMsg = _e.what();
+        }
+        catch (...)
+        {
+            m_errMsg = "unknown error";
+        }
+
+        return false;
+    }
+
+    bool w2vModel_t::loadVocab(const std::string &_vocabFile) noexcept
+    {
+        try
+        {
+            m_frequencies.clear();
+
+            std::ifstream input(_vocabFile);
+            if (!input)
+            {
+                throw std::runtime_error("vocabulary: can not open file " + _vocabFile);
             }
 
-            // get pairs of word and vector
-            offset++; // skip last '\n' char
             std::string word;
-            for (std::size_t i = 0; i < m_mapSize; ++i)
+            std::size_t frequency = 0;
+            while (input >> word >> frequency)
             {
-                // get word
-                word.clear();
-                while ((ch = (*(input.data() + offset))) != ' ')
-                {
-                    if (ch != '\n')
-                    {
-                        word += ch;
-                    }
-                    // move to the next char and check boundaries
-                    if (++offset >= input.size())
-                    {
-                        throw std::runtime_error(wrongFormatErrMsg);
-                    }
-                }
+                m_frequencies[word] = frequency;
+            }
 
-                // skip last ' ' char and check boundaries
-                if (static_cast<off_t>(++offset + m_vectorSize * sizeof(float)) > input.size())
-                {
-                    throw std::runtime_error(wrongFormatErrMsg);
-                }
+            if (!input.eof())
+            {
+                throw std::runtime_error("vocabulary: wrong file format");
+            }
 
-                // get word's vector
-                auto &v = m_map[word];
-                v.resize(m_vectorSize);
-                std::memcpy(v.data(), input.data() + offset, m_vectorSize * sizeof(float));
-                offset += m_vectorSize * sizeof(float); // vector size
+            return true;
+        }
+        catch (const std::exception &_e)
+        {
+            m_errMsg = _e.what();
+        }
+        catch (...)
+        {
+            m_errMsg = "unknown error";
+        }
 
-                // normalize vector
-                float med = 0.0f;
-                for (auto const &j : v)
-                {
-                    med += j * j;
-                }
-                if (med <= 0.0f)
-                {
-                    throw std::runtime_error("failed to normalize vectors");
-                }
-                med = std::sqrt(med / v.size());
-                for (auto &j : v)
-                {
-                    j /= med;
-                }
+        m_frequencies.clear();
+
+        return false;
+    }
+
+    bool w2vModel_t::load(const std::string &_modelFile) noexcept
+    {
+        try
+        {
+            m_map.clear();
+            m_mapSize = readVectors(_modelFile, m_map, m_vectorSize, true);
+            m_weights.clear();
+            m_resumable = false;
+            m_subwords.reset();
+            m_ngramVectors.clear();
+
+            return true;
+        }
+        catch (const std::exception &_e)
+        {
+            m_errMsg = _e.what();
+        }
+        catch (...)
+        {
+            m_errMsg = "unknown error";
+        }
+
+        return false;
+    }
+
+    bool w2vModel_t::resume(const std::string &_modelFile) noexcept
+    {
+        try
+        {
+            // the vectors of a subword model are composed from n-gram rows that can't be trained further
+            if (std::ifstream(_modelFile + ".subwords"))
+            {
+                throw std::runtime_error("continued training does not support models with subword vectors");
+            }
+
+            // raw vectors, the loaded ones are normalized
+            m_map.clear();
+            m_mapSize = readVectors(_modelFile, m_map, m_vectorSize, false);
+
+            if (!loadVocab(_modelFile + ".vocab"))
+            {
+                throw std::runtime_error(m_errMsg);
             }
 
+            uint16_t weightsSize = 0;
+            m_weights.clear();
+            readVectors(_modelFile + ".weights", m_weights, weightsSize, false);
+            if (weightsSize != m_vectorSize)
+            {
+                throw std::runtime_error("weights: vector size does not match the model");
+            }
+
+            m_resumable = true;
+
             return true;
         }
         catch (const std::exception &_e)
@@ -244,12 +694,116 @@ namespace w2v
         }
         catch (...)
         {
-            m_errMsg = "model: unknown error";
+            m_errMsg = "unknown error";
         }
 
+        m_map.clear();
+        m_weights.clear();
+        m_frequencies.clear();
+
         return false;
     }
 
+    std::size_t w2vModel_t::readVectors(const std::string &_file, map_t &_map, uint16_t &_vectorSize, bool _normalize) const
+    {
+        std::size_t mapSize = 0;
+
+        // map model file, exception will be thrown on empty file
+        fileMapper_t input(_file);
+
+        // parse header
+        off_t offset = 0;
+        // get words number
+        std::string nwStr;
+        char ch = 0;
+        while ((ch = (*(input.data() + offset))) != ' ')
+        {
+            nwStr += ch;
+            if (++offset >= input.size())
+            {
+                throw std::runtime_error(wrongFormatErrMsg);
+            }
+        }
+
+        // get vector size
+        offset++; // skip ' ' char
+        std::string vsStr;
+        while ((ch = (*(input.data() + offset))) != '\n')
+        {
+            vsStr += ch;
+            if (++offset >= input.size())
+            {
+                throw std::runtime_error(wrongFormatErrMsg);
+            }
+        }
+
+        try
+        {
+            mapSize = static_cast<std::size_t>(std::stoll(nwStr));
+            _vectorSize = static_cast<uint16_t>(std::stoi(vsStr));
+        }
+        catch (...)
+        {
+            throw std::runtime_error(wrongFormatErrMsg);
+        }
+
+        // get pairs of word and vector
+        offset++; // skip last '\n' char
+        std::string word;
+        for (std::size_t i = 0; i < mapSize; ++i)
+        {
+            // get word
+            word.clear();
+            while ((ch = (*(input.data() + offset))) != ' ')
+            {
+                if (ch != '\n')
+                {
+                    word += ch;
+                }
+                // move to the next char and check boundaries
+                if (++offset >= input.size())
+                {
+                    throw std::runtime_error(wrongFormatErrMsg);
+                }
+            }
+
+            // skip last ' ' char and check boundaries
+            if (static_cast<off_t>(++offset + _vectorSize * sizeof(float)) > input.size())
+            {
+                throw std::runtime_error(wrongFormatErrMsg);
+            }
+
+            // get word's vector
+            auto &v = _map[word];
+            v.resize(_vectorSize);
+            std::memcpy(v.data(), input.data() + offset, _vectorSize * sizeof(float));
+            offset += _vectorSize * sizeof(float); // vector size
+
+            if (!_normalize)
+            {
+                continue;
+            }
+
+            // normalize vector
+            float med = 0.0f;
+            for (auto const &j : v)
+            {
+                med += j * j;
+            }
+            if (med <= 0.0f)
+            {
+                throw std::runtime_error("failed to normalize vectors");
+            }
+            med = std::sqrt(med / v.size());
+            for (auto &j : v)
+            {
+                j /= med;
+            }
+        }
+
+        return mapSize;
+    }
+
     //
     //
     //
@@ -386,10 +940,10 @@ namespace w2v
 
     word2vec_t::word2vec_t(const std::unique_ptr<w2vModel_t> &_model, const std::string &_word) : vector_t(_model->vectorSize())
     {
-        auto i = _model->vector(_word);
-        if (i != nullptr)
+        vector_t v;
+        if (_model->wordVector(_word, v))
         {
-            std::copy(i->begin(), i->end(), begin());
+            std::copy(v.begin(), v.end(), begin());
         }
     }
 
@@ -404,20 +958,21 @@ namespace w2v
         stringMapper_t stringMapper(_doc);
         wordReader_t<stringMapper_t> wordReader(stringMapper, _wordDelimiterChars, "");
         std::string word;
+        vector_t next;
         while (wordReader.nextWord(word))
         {
             if (word.empty())
             {
                 continue;
             }
-            auto next = _model->vector(word);
-            if (next == nullptr)
+            // unknown words count when the model can compose them from subwords
+            if (!_model->wordVector(word, next))
             {
                 continue;
             }
             for (uint16_t i = 0; i < _model->vectorSize(); ++i)
             {
-                (*this)[i] += (*next)[i];
+                (*this)[i] += next[i];
             }
         }
         float med = 0.0f;
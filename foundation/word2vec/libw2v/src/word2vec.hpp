@@ -9,6 +9,7 @@
 #ifndef WORD2VEC_WORD2VEC_HPP
 #define WORD2VEC_WORD2VEC_HPP
 
+#include <atomic>
 #include <cassert>
 #include <string>
 #include <vector>
@@ -21,6 +22,9 @@
 
 namespace w2v
 {
+    class mapper_t;
+    class subwords_t;
+
     /**
      * @brief trainSettings structure holds all training parameters
      */
@@ -38,8 +42,12 @@ namespace w2v
         uint8_t iterations = 5;       ///< train iterations
         float alpha = 0.05f;          ///< starting learn rate
         bool withSG = false;          ///< use Skip-Gram instead of CBOW
+        uint8_t minN = 0;             ///< min length of character n-grams, subword vectors are trained when > 0
+        uint8_t maxN = 0;             ///< max length of character n-grams
+        uint32_t buckets = 2000000;   ///< number of hash buckets shared by character n-grams
         std::string wordDelimiterChars = " \n,.-!?:;/\"#$%&'()*+<=>@[]\\^_`{|}~\t\v\f\r";
         std::string endOfSentenceChars = ".\n?!";
+        const std::atomic<bool> *stop = nullptr; ///< when set, parsing and training stop as soon as possible
         trainSettings_t() = default;
     };
 
@@ -310,10 +318,105 @@ namespace w2v
                    vocabularyStatsCallback_t _vocabularyStatsCallback,
                    trainProgressCallback_t _trainProgressCallback) noexcept;
 
+        /**
+         * Trains model from train corpus data held in memory
+         * @param _trainSettings trainSettings_t structure with training parameters
+         * @param _trainData train corpus data, it must stay valid until training returns
+         * @param _trainSize size of train corpus data in bytes
+         * @param _stopWordsFile file name with stop words
+         * @param _vocabularyProgressCallback callback function reporting train corpus data parsing progress,
+         * nullptr if progress statistic is not needed
+         * @param _vocabularyStatsCallback callback function reporting train corpus statistic,
+         * nullptr if train data corpus statistic is not needed
+         * @param _trainProgressCallback callback function reporting training progress,
+         * nullptr if training progress statistic is not needed
+         * @returns true on successful completion or false otherwise
+         */
+        bool train(const trainSettings_t &_trainSettings,
+                   const char *_trainData,
+                   std::size_t _trainSize,
+                   const std::string &_stopWordsFile,
+                   vocabularyProgressCallback_t _vocabularyProgressCallback,
+                   vocabularyStatsCallback_t _vocabularyStatsCallback,
+                   trainProgressCallback_t _trainProgressCallback) noexcept;
+
         /// saves word vectors to file with _modelFile name
         bool save(const std::string &_modelFile) const noexcept override;
         /// loads word vectors from file with _modelFile name
         bool load(const std::string &_modelFile) noexcept override;
+
+        /**
+         * Prepares the model saved in _modelFile for continued training, the next train call extends its
+         * vocabulary with the new words and trains the existing vectors further instead of starting from
+         * scratch. The vocabulary (_modelFile + ".vocab") and output weights (_modelFile + ".weights") files
+         * written next to the model are required, output weights are saved for negative sampling only.
+         * @param _modelFile file name of the model to continue training
+         * @returns true on successful completion or false otherwise
+         */
+        bool resume(const std::string &_modelFile) noexcept;
+
+        /// saves output weights of the last negative sampling training to file with _weightsFile name
+        bool saveWeights(const std::string &_weightsFile) const noexcept;
+
+        /// @returns true when output weights of the last training are available
+        inline bool hasWeights() const noexcept { return !m_weights.empty(); }
+
+        /**
+         * Word vector access, a word missing from the model gets a vector composed from the vectors of its
+         * character n-grams when the model has subword vectors
+         * @param _word word to look up
+         * @param[out] _vector normalized word vector
+         * @returns false when the word is not known and no vector can be composed for it
+         */
+        bool wordVector(const std::string &_word, vector_t &_vector) const noexcept;
+
+        /// saves character n-gram vectors of the last training with subwords to file with _subwordsFile name
+        bool saveSubwords(const std::string &_subwordsFile) const noexcept;
+        /// loads character n-gram vectors from file with _subwordsFile name, a missing file is not an error
+        bool loadSubwords(const std::string &_subwordsFile) noexcept;
+
+        /// @returns true when the model has character n-gram vectors
+        inline bool hasSubwords() const noexcept { return m_subwords != nullptr; }
+
+    private:
+        void train(const trainSettings_t &_trainSettings,
+                   std::shared_ptr<mapper_t> &_trainWordsMapper,
+                   const std::string &_stopWordsFile,
+                   vocabularyProgressCallback_t _vocabularyProgressCallback,
+                   vocabularyStatsCallback_t _vocabularyStatsCallback,
+                   trainProgressCallback_t _trainProgressCallback);
+
+        std::size_t readVectors(const std::string &_file, map_t &_map, uint16_t &_vectorSize, bool _normalize) const;
+        static void writeVectors(const std::string &_file, const map_t &_map, uint16_t _vectorSize);
+
+    public:
+        /// saves word frequencies to file with _vocabFile name, one "word frequency" pair per line
+        bool saveVocab(const std::string &_vocabFile) const noexcept;
+        /// loads word frequencies from file with _vocabFile name
+        bool loadVocab(const std::string &_vocabFile) noexcept;
+
+        /**
+         * Word frequency access
+         * @param _word word to look up
+         * @returns frequency of the word in the train data or 0 if it is not known
+         */
+        inline std::size_t frequency(const std::string &_word) const noexcept
+        {
+            auto const &i = m_frequencies.find(_word);
+            if (i != m_frequencies.end())
+            {
+                return i->second;
+            }
+
+            return 0;
+        }
+
+    private:
+        std::unordered_map<std::string, std::size_t> m_frequencies;
+        map_t m_weights;
+        bool m_resumable = false;
+        std::shared_ptr<subwords_t> m_subwords;
+        std::unordered_map<std::size_t, vector_t> m_ngramVectors;
     };
 
     /**
@@ -0,0 +1,510 @@
+// Package phrases learns the phrases of a corpus, like "battery life" or
+// "customer service", so word2vec can train a vector for each phrase. The
+// corpus is rewritten with the words of a phrase joined into one token,
+// "battery_life", before training, and the phrase table is saved so
+// queries are rewritten the same way.
+package phrases
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scoring represents the function used to score a pair of words.
+type Scoring int
+
+// Set of scoring functions.
+const (
+	// ScoreCount is the score of the original word2phrase tool:
+	// (count(a b) - MinCount) * words / (count(a) * count(b)).
+	ScoreCount Scoring = iota
+
+	// ScoreNPMI is the normalized pointwise mutual information of the pair,
+	// from -1 to 1, which doesn't depend on the size of the corpus.
+	ScoreNPMI
+)
+
+// String implements the fmt.Stringer interface.
+func (s Scoring) String() string {
+	switch s {
+	case ScoreCount:
+		return "count"
+	case ScoreNPMI:
+		return "npmi"
+	}
+
+	return fmt.Sprintf("scoring(%d)", int(s))
+}
+
+// Sentences represents a sequence of sentences to learn from. It calls
+// yield for every sentence and stops when yield returns false. It has the
+// same signature as word2vec.Sentences.
+type Sentences func(yield func(sentence string) bool) error
+
+// Config defines the settings to learn phrases.
+type Config struct {
+	// Tokenizer represents the word delimiters. It must not include the
+	// Delimiter and the same tokenizer must be used to train the model.
+	// Ex: " \n,.-!?:;/\"#$%&'()*+<=>@[]\\^`{|}~\t\v\f\r"
+	Tokenizer string
+
+	// Sequencer represents the end of a sentence. Phrases don't cross the
+	// end of a sentence.
+	// Ex: ".\n?!"
+	Sequencer string
+
+	// Delimiter represents the string joining the words of a phrase.
+	// Ex: "_"
+	Delimiter string
+
+	// Scoring represents the function used to score a pair of words.
+	// Ex: ScoreCount
+	Scoring Scoring
+
+	// MinCount represents when words and pairs should be ignored that appear
+	// less than <int> times.
+	// Ex: 5
+	MinCount int
+
+	// Threshold represents the score a pair needs to become a phrase. Higher
+	// values give fewer phrases.
+	// Ex: 100 with ScoreCount, 0.5 with ScoreNPMI
+	Threshold float64
+
+	// Trigrams represents a second pass that joins the learned phrases with
+	// another word into phrases of three words.
+	Trigrams bool
+}
+
+// NewConfigDefault defines a set of default configuration options. The
+// tokenizer is the default word2vec one without the delimiter.
+func NewConfigDefault() Config {
+	return Config{
+		Tokenizer: " \n,.-!?:;/\"#$%&'()*+<=>@[]\\^`{|}~\t\v\f\r",
+		Sequencer: ".\n?!",
+		Delimiter: "_",
+		Scoring:   ScoreCount,
+		MinCount:  5,
+		Threshold: 100,
+		Trigrams:  false,
+	}
+}
+
+// =============================================================================
+
+// Phrase represents a learned phrase and its score.
+type Phrase struct {
+	Phrase string
+	Score  float64
+}
+
+// Table represents a learned phrase table. It has a layer of word pairs
+// for every pass, the second pass pairs the phrases of the first one with
+// another word.
+type Table struct {
+	tokenizer string
+	sequencer string
+	delimiter string
+	layers    []map[pair]float64
+}
+
+type pair struct {
+	first  string
+	second string
+}
+
+// Learn scores the pairs of adjacent words of the sentences and keeps the
+// pairs scoring above the threshold. The sentences are read once for every
+// pass, twice with trigrams.
+func Learn(sentences Sentences, config Config) (*Table, error) {
+	switch {
+	case config.Delimiter == "":
+		return nil, errors.New("delimiter is required")
+
+	case strings.ContainsAny(config.Tokenizer, config.Delimiter):
+		return nil, fmt.Errorf("tokenizer includes the delimiter %q", config.Delimiter)
+
+	case config.Scoring != ScoreCount && config.Scoring != ScoreNPMI:
+		return nil, fmt.Errorf("unknown scoring %d", config.Scoring)
+	}
+
+	t := Table{
+		tokenizer: config.Tokenizer,
+		sequencer: config.Sequencer,
+		delimiter: config.Delimiter,
+	}
+
+	passes := 1
+	if config.Trigrams {
+		passes = 2
+	}
+
+	for pass := 0; pass < passes; pass++ {
+		layer, err := t.learn(sentences, config, pass)
+		if err != nil {
+			return nil, fmt.Errorf("pass %d: %w", pass+1, err)
+		}
+
+		t.layers = append(t.layers, layer)
+	}
+
+	return &t, nil
+}
+
+// Load reads a phrase table written by Save.
+func Load(fileTable string) (*Table, error) {
+	f, err := os.Open(fileTable)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Read reads a phrase table written by Write.
+func Read(r io.Reader) (*Table, error) {
+	br := bufio.NewReader(r)
+
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	// The header holds the quoted delimiter, tokenizer and sequencer.
+	var fields []string
+	rest := strings.TrimSuffix(header, "\n")
+	for len(rest) > 0 {
+		var field string
+		var ok bool
+		if field, rest, ok = unquote(rest); !ok {
+			return nil, fmt.Errorf("wrong phrase table format: header %q", header)
+		}
+
+		fields = append(fields, field)
+	}
+
+	if len(fields) != 3 || fields[0] == "" {
+		return nil, fmt.Errorf("wrong phrase table format: header %q", header)
+	}
+
+	t := Table{
+		delimiter: fields[0],
+		tokenizer: fields[1],
+		sequencer: fields[2],
+	}
+
+	scanner := bufio.NewScanner(br)
+
+	line := 1
+	for scanner.Scan() {
+		line++
+
+		// Every line holds the pass, the two quoted words and the score. The
+		// words are quoted since a tokenizer may leave spaces in them.
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		passField, rest, _ := strings.Cut(text, " ")
+
+		first, rest, ok := unquote(rest)
+		if !ok {
+			return nil, fmt.Errorf("line %d: wrong phrase table format", line)
+		}
+
+		second, scoreField, ok := unquote(rest)
+		if !ok || scoreField == "" || strings.Contains(scoreField, " ") {
+			return nil, fmt.Errorf("line %d: wrong phrase table format", line)
+		}
+
+		pass, err := strconv.Atoi(passField)
+		if err != nil || pass < 1 || pass > len(t.layers)+1 {
+			return nil, fmt.Errorf("line %d: wrong pass %q", line, passField)
+		}
+
+		score, err := strconv.ParseFloat(scoreField, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: score: %w", line, err)
+		}
+
+		if pass > len(t.layers) {
+			t.layers = append(t.layers, make(map[pair]float64))
+		}
+
+		t.layers[pass-1][pair{first: first, second: second}] = score
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	return &t, nil
+}
+
+// Save writes the phrase table to the specified file.
+func (t *Table) Save(fileTable string) error {
+	f, err := os.Create(fileTable)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	if err := t.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+
+	return nil
+}
+
+// Write writes the phrase table with its tokenizer settings, so a loaded
+// table rewrites text the same way.
+func (t *Table) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "%s %s %s\n", strconv.Quote(t.delimiter), strconv.Quote(t.tokenizer), strconv.Quote(t.sequencer))
+
+	for i, layer := range t.layers {
+		pairs := make([]pair, 0, len(layer))
+		for p := range layer {
+			pairs = append(pairs, p)
+		}
+
+		sort.Slice(pairs, func(a, b int) bool {
+			if pairs[a].first != pairs[b].first {
+				return pairs[a].first < pairs[b].first
+			}
+			return pairs[a].second < pairs[b].second
+		})
+
+		for _, p := range pairs {
+			fmt.Fprintf(bw, "%d %s %s %s\n", i+1, strconv.Quote(p.first), strconv.Quote(p.second), strconv.FormatFloat(layer[p], 'g', -1, 64))
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("write phrase table: %w", err)
+	}
+
+	return nil
+}
+
+// Tokenizer returns the word delimiters of the table. Use it as the
+// tokenizer of the training run and of the trained model, so the joined
+// phrases aren't split again.
+func (t *Table) Tokenizer() string {
+	return t.tokenizer
+}
+
+// Phrases returns the learned phrases, the highest score first.
+func (t *Table) Phrases() []Phrase {
+	var phrases []Phrase
+
+	for _, layer := range t.layers {
+		for p, score := range layer {
+			phrases = append(phrases, Phrase{
+				Phrase: p.first + t.delimiter + p.second,
+				Score:  score,
+			})
+		}
+	}
+
+	sort.Slice(phrases, func(i, j int) bool {
+		if phrases[i].Score != phrases[j].Score {
+			return phrases[i].Score > phrases[j].Score
+		}
+		return phrases[i].Phrase < phrases[j].Phrase
+	})
+
+	return phrases
+}
+
+// Rewrite splits the text into words and joins the words of the learned
+// phrases. The words are separated by a space and the sentences by a
+// newline. Rewrite queries before passing them to Embedding or Lookup.
+func (t *Table) Rewrite(text string) string {
+	var sb strings.Builder
+
+	for i, sentence := range t.sentences(text) {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+
+		sb.WriteString(strings.Join(t.join(sentence, len(t.layers)), " "))
+	}
+
+	return sb.String()
+}
+
+// Sentences rewrites every sentence of the sequence, so a corpus can be
+// rewritten while it's streamed to the trainer with SentenceReader.
+func (t *Table) Sentences(sentences Sentences) Sentences {
+	return func(yield func(sentence string) bool) error {
+		return sentences(func(sentence string) bool {
+			return yield(t.Rewrite(sentence))
+		})
+	}
+}
+
+// =============================================================================
+
+// learn counts the words and pairs of the sentences, after joining the
+// phrases of the earlier passes, and scores the pairs.
+func (t *Table) learn(sentences Sentences, config Config, pass int) (map[pair]float64, error) {
+	words := make(map[string]int)
+	pairs := make(map[pair]int)
+
+	var total int
+
+	err := sentences(func(text string) bool {
+		for _, sentence := range t.sentences(text) {
+			tokens := t.join(sentence, pass)
+
+			for i, token := range tokens {
+				words[token]++
+				total++
+
+				if i > 0 {
+					pairs[pair{first: tokens[i-1], second: token}]++
+				}
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read sentences: %w", err)
+	}
+
+	layer := make(map[pair]float64)
+
+	for p, count := range pairs {
+		if count < config.MinCount || words[p.first] < config.MinCount || words[p.second] < config.MinCount {
+			continue
+		}
+
+		// The second pass only extends the phrases of the first one.
+		if pass > 0 && strings.Contains(p.first, t.delimiter) == strings.Contains(p.second, t.delimiter) {
+			continue
+		}
+
+		score := t.score(config, count, words[p.first], words[p.second], total)
+		if score > config.Threshold {
+			layer[p] = score
+		}
+	}
+
+	return layer, nil
+}
+
+func (t *Table) score(config Config, pairCount int, firstCount int, secondCount int, total int) float64 {
+	switch config.Scoring {
+	case ScoreNPMI:
+		pab := float64(pairCount) / float64(total)
+		pa := float64(firstCount) / float64(total)
+		pb := float64(secondCount) / float64(total)
+
+		if pab >= 1 {
+			return 1
+		}
+
+		return math.Log(pab/(pa*pb)) / -math.Log(pab)
+	}
+
+	return float64(pairCount-config.MinCount) * float64(total) / (float64(firstCount) * float64(secondCount))
+}
+
+// sentences splits the text into sentences of words.
+func (t *Table) sentences(text string) [][]string {
+	var sentences [][]string
+	var words []string
+
+	start := -1
+	for i, r := range text {
+		end := strings.ContainsRune(t.sequencer, r)
+
+		if end || strings.ContainsRune(t.tokenizer, r) {
+			if start >= 0 {
+				words = append(words, text[start:i])
+				start = -1
+			}
+
+			if end && len(words) > 0 {
+				sentences = append(sentences, words)
+				words = nil
+			}
+
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, text[start:])
+	}
+
+	if len(words) > 0 {
+		sentences = append(sentences, words)
+	}
+
+	return sentences
+}
+
+// join joins the pairs of words found in the first layers of the table,
+// left to right, one layer after the other.
+func (t *Table) join(words []string, layers int) []string {
+	for _, layer := range t.layers[:layers] {
+		if len(layer) == 0 || len(words) < 2 {
+			continue
+		}
+
+		joined := make([]string, 0, len(words))
+
+		for i := 0; i < len(words); i++ {
+			if i+1 < len(words) {
+				if _, exists := layer[pair{first: words[i], second: words[i+1]}]; exists {
+					joined = append(joined, words[i]+t.delimiter+words[i+1])
+					i++
+					continue
+				}
+			}
+
+			joined = append(joined, words[i])
+		}
+
+		words = joined
+	}
+
+	return words
+}
+
+// unquote returns the quoted string at the start of s and the rest of s
+// after the space that follows it.
+func unquote(s string) (string, string, bool) {
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", false
+	}
+
+	field, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", "", false
+	}
+
+	return field, strings.TrimPrefix(s[len(quoted):], " "), true
+}
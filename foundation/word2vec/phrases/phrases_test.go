@@ -0,0 +1,179 @@
+package phrases
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var corpus = []string{
+	"I moved to New York City last year.",
+	"New York City is loud. The subway in New York City never sleeps!",
+	"She flew from New York to the West Coast.",
+	"The West Coast is sunny, and New York City is not?",
+	"We took the subway to work and the subway was late.",
+	"Is New York City bigger than the West Coast cities",
+}
+
+func sentences(yield func(sentence string) bool) error {
+	for _, s := range corpus {
+		if !yield(s) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		scoring  Scoring
+		trigrams bool
+		phrase   string
+		text     string
+		exp      string
+	}{
+		{
+			name:    "count",
+			scoring: ScoreCount,
+			phrase:  "new_york",
+			text:    "Flights to New York. Sunny West Coast",
+			exp:     "flights to new_york\nsunny west_coast",
+		},
+		{
+			name:    "npmi",
+			scoring: ScoreNPMI,
+			phrase:  "west_coast",
+			text:    "a sunny West Coast",
+			exp:     "a sunny west_coast",
+		},
+		{
+			name:     "trigrams",
+			scoring:  ScoreCount,
+			trigrams: true,
+			phrase:   "new_york_city",
+			text:     "Lost in New York City!",
+			exp:      "lost in new_york_city",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewConfigDefault()
+			config.Scoring = tt.scoring
+			config.Trigrams = tt.trigrams
+			config.MinCount = 2
+			config.Threshold = 0.5
+
+			// Lower case the corpus the way it's prepared for training.
+			lower := func(yield func(sentence string) bool) error {
+				return sentences(func(s string) bool {
+					return yield(strings.ToLower(s))
+				})
+			}
+
+			learned, err := Learn(lower, config)
+			if err != nil {
+				t.Fatalf("learn: %s", err)
+			}
+
+			if !slices.ContainsFunc(learned.Phrases(), func(p Phrase) bool { return p.Phrase == tt.phrase }) {
+				t.Fatalf("phrases: %q not found in %v", tt.phrase, learned.Phrases())
+			}
+
+			file := filepath.Join(t.TempDir(), "test.phrases")
+			if err := learned.Save(file); err != nil {
+				t.Fatalf("save: %s", err)
+			}
+
+			loaded, err := Load(file)
+			if err != nil {
+				t.Fatalf("load: %s", err)
+			}
+
+			if !slices.Equal(loaded.Phrases(), learned.Phrases()) {
+				t.Fatalf("phrases: got %v, exp %v", loaded.Phrases(), learned.Phrases())
+			}
+
+			if loaded.Tokenizer() != learned.Tokenizer() {
+				t.Fatalf("tokenizer: got %q, exp %q", loaded.Tokenizer(), learned.Tokenizer())
+			}
+
+			text := strings.ToLower(tt.text)
+
+			if got := learned.Rewrite(text); got != tt.exp {
+				t.Fatalf("rewrite learned: got %q, exp %q", got, tt.exp)
+			}
+
+			if got := loaded.Rewrite(text); got != tt.exp {
+				t.Fatalf("rewrite loaded: got %q, exp %q", got, tt.exp)
+			}
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	// The default tokenizer only splits on ASCII spaces, so the no-break
+	// spaces stay inside the words.
+	text := "the 10\u00a0km run. a 10\u00a0km run. our 10\u00a0km run."
+
+	sentences := func(yield func(sentence string) bool) error {
+		yield(text)
+		return nil
+	}
+
+	config := NewConfigDefault()
+	config.MinCount = 2
+	config.Threshold = 0.1
+
+	learned, err := Learn(sentences, config)
+	if err != nil {
+		t.Fatalf("learn: %s", err)
+	}
+
+	if exp := "10\u00a0km_run"; !slices.ContainsFunc(learned.Phrases(), func(p Phrase) bool { return p.Phrase == exp }) {
+		t.Fatalf("phrases: %q not found in %v", exp, learned.Phrases())
+	}
+
+	var buf bytes.Buffer
+	if err := learned.Write(&buf); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	loaded, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+
+	if !slices.Equal(loaded.Phrases(), learned.Phrases()) {
+		t.Fatalf("phrases: got %v, exp %v", loaded.Phrases(), learned.Phrases())
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"header fields", "\"_\" \" \"\n"},
+		{"header quotes", "_ \" \" \".\"\n"},
+		{"empty delimiter", "\"\" \" \" \".\"\n"},
+		{"line fields", "\"_\" \" \" \".\"\n1 \"new\" \"york\"\n"},
+		{"line quotes", "\"_\" \" \" \".\"\n1 new york 1.5\n"},
+		{"line extra fields", "\"_\" \" \" \".\"\n1 \"new\" \"york\" 1.5 2\n"},
+		{"pass", "\"_\" \" \" \".\"\n2 \"new\" \"york\" 1.5\n"},
+		{"score", "\"_\" \" \" \".\"\n1 \"new\" \"york\" x\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,868 @@
+// Package purego provides a pure Go reader for the word2vec model files
+// written by libw2v, so a trained model can be used for inference on
+// machines without the prebuilt library. Both the binary format written by
+// w2vModel_t::save and the original word2vec text format are supported, as
+// are pretrained GloVe and fastText .vec files.
+package purego
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Nearest represents the word and the percent of closeness.
+type Nearest struct {
+	Word     string
+	Distance float32
+}
+
+// Set of limits applied to the counts read from a file header, so a corrupt
+// or hostile header can't exhaust memory before any vector is read. Models
+// with more values than maxPreallocate grow while they are read.
+const (
+	maxVectorSize  = 1 << 16
+	maxPreallocate = 1 << 20
+)
+
+// =============================================================================
+
+// Model represents a word2vec model held in memory. The vectors are stored
+// in a single contiguous matrix, one row per word, in file order.
+type Model struct {
+	fileModel  string
+	vectorSize int
+	words      []string
+	index      map[string]int
+	matrix     []float32
+	freqs      map[string]int
+	subwords   *subwords
+	tokenizer  string
+}
+
+// subwords represents the character n-gram vectors of a model trained with
+// subwords. Only the buckets used by the vocabulary are stored.
+type subwords struct {
+	minN    int
+	maxN    int
+	buckets uint32
+	vectors map[uint32][]float32
+}
+
+// Load takes a file on disk and loads it for processing. The vector size is
+// read from the file; when vector isn't zero it must match. Word
+// frequencies and subword vectors are read from the vocabulary and subword
+// files written next to the model by Train, when they exist. Pretrained
+// fastText .vec files use the word2vec text format and load the same way.
+func Load(fileModel string, vector int) (Model, error) {
+	f, err := os.Open(fileModel)
+	if err != nil {
+		return Model{}, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	m, err := Read(f, vector)
+	if err != nil {
+		return Model{}, err
+	}
+
+	m.fileModel = fileModel
+
+	if err := m.loadVocab(fileModel + ".vocab"); err != nil {
+		return Model{}, err
+	}
+
+	if err := m.loadSubwords(fileModel + ".subwords"); err != nil {
+		return Model{}, err
+	}
+
+	return m, nil
+}
+
+// Read loads a model from the reader. The vector size is read from the
+// header; when vector isn't zero it must match.
+func Read(r io.Reader, vector int) (Model, error) {
+	br := bufio.NewReader(r)
+
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return Model{}, fmt.Errorf("read header: %w", err)
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return Model{}, fmt.Errorf("wrong model file format: header %q", header)
+	}
+
+	words, err := strconv.Atoi(fields[0])
+	if err != nil || words < 0 {
+		return Model{}, fmt.Errorf("wrong model file format: words %q", fields[0])
+	}
+
+	size, err := strconv.Atoi(fields[1])
+	if err != nil || size <= 0 || size > maxVectorSize {
+		return Model{}, fmt.Errorf("wrong model file format: vector size %q", fields[1])
+	}
+
+	if vector != 0 && vector != size {
+		return Model{}, fmt.Errorf("model vector size is %d, not %d", size, vector)
+	}
+
+	prealloc := min(words, maxPreallocate/size)
+
+	m := Model{
+		vectorSize: size,
+		words:      make([]string, 0, prealloc),
+		index:      make(map[string]int, prealloc),
+		matrix:     make([]float32, 0, prealloc*size),
+	}
+
+	// The buffer must hold a full text vector to detect the format.
+	br = bufio.NewReaderSize(br, size*32+64)
+
+	var binary, detected bool
+	zero := make([]float32, size)
+
+	for i := 0; i < words; i++ {
+		word, err := readWord(br)
+		if err != nil {
+			return Model{}, fmt.Errorf("word %d: %w", i, err)
+		}
+
+		if !detected {
+			binary, err = isBinary(br, size)
+			if err != nil {
+				return Model{}, fmt.Errorf("word %d: %w", i, err)
+			}
+			detected = true
+		}
+
+		row := len(m.matrix)
+		m.matrix = append(m.matrix, zero...)
+
+		switch binary {
+		case true:
+			err = readBinaryVector(br, m.matrix[row:])
+		default:
+			err = readTextVector(br, m.matrix[row:])
+		}
+
+		if err != nil {
+			return Model{}, fmt.Errorf("word %d %q: %w", i, word, err)
+		}
+
+		if err := m.commit(word); err != nil {
+			return Model{}, fmt.Errorf("word %d %q: %w", i, word, err)
+		}
+	}
+
+	return m, nil
+}
+
+// LoadGloVe takes a file of pretrained GloVe vectors and loads it for
+// processing, so the vectors can be compared with a trained model through
+// the same API. fastText .vec files have a header and are read by Load.
+func LoadGloVe(fileModel string, vector int) (Model, error) {
+	f, err := os.Open(fileModel)
+	if err != nil {
+		return Model{}, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	m, err := ReadGloVe(f, vector)
+	if err != nil {
+		return Model{}, err
+	}
+
+	m.fileModel = fileModel
+
+	return m, nil
+}
+
+// ReadGloVe loads GloVe vectors from the reader. The GloVe text format has
+// no header, one "word value..." line per word, so the vector size is taken
+// from the first line; when vector isn't zero it must match. Words holding
+// spaces, found in some of the Common Crawl releases, are kept whole.
+func ReadGloVe(r io.Reader, vector int) (Model, error) {
+	br := bufio.NewReader(r)
+
+	m := Model{
+		vectorSize: vector,
+		index:      make(map[string]int),
+	}
+
+	for line := 1; ; line++ {
+		text, err := br.ReadString('\n')
+		switch {
+		case errors.Is(err, io.EOF) && text == "":
+			if len(m.words) == 0 {
+				return Model{}, errors.New("wrong model file format: no vectors")
+			}
+			return m, nil
+
+		case err != nil && !errors.Is(err, io.EOF):
+			return Model{}, fmt.Errorf("line %d: read: %w", line, err)
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if m.vectorSize == 0 {
+			m.vectorSize = len(fields) - 1
+		}
+
+		if len(fields) <= m.vectorSize {
+			return Model{}, fmt.Errorf("line %d: vector has %d values, expected %d", line, len(fields)-1, m.vectorSize)
+		}
+
+		split := len(fields) - m.vectorSize
+		word := strings.Join(fields[:split], " ")
+
+		row := len(m.matrix)
+		m.matrix = append(m.matrix, make([]float32, m.vectorSize)...)
+
+		for i, field := range fields[split:] {
+			v, err := strconv.ParseFloat(field, 32)
+			if err != nil {
+				return Model{}, fmt.Errorf("line %d %q: parse value %d: %w", line, word, i, err)
+			}
+
+			m.matrix[row+i] = float32(v)
+		}
+
+		if err := m.commit(word); err != nil {
+			return Model{}, fmt.Errorf("line %d %q: %w", line, word, err)
+		}
+	}
+}
+
+// ReadVocab reads the word frequencies from a vocabulary file, one "word
+// frequency" pair per line.
+func (m *Model) ReadVocab(r io.Reader) error {
+	freqs := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+
+	var line int
+	for scanner.Scan() {
+		line++
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: wrong vocabulary file format", line)
+		}
+
+		freq, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fmt.Errorf("line %d: frequency: %w", line, err)
+		}
+
+		freqs[fields[0]] = freq
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	m.freqs = freqs
+
+	return nil
+}
+
+// ReadSubwords reads the character n-gram vectors from a subwords file
+// written by Train. Words missing from the vocabulary then get a vector
+// composed from their n-grams.
+func (m *Model) ReadSubwords(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+
+	var vectors, size, minN, maxN int
+	var buckets uint32
+	if _, err := fmt.Sscan(header, &vectors, &size, &minN, &maxN, &buckets); err != nil {
+		return fmt.Errorf("wrong subwords file format: header %q", header)
+	}
+
+	if size != m.vectorSize {
+		return fmt.Errorf("subwords vector size is %d, not %d", size, m.vectorSize)
+	}
+
+	if vectors < 0 || minN <= 0 || maxN < minN || buckets == 0 {
+		return fmt.Errorf("wrong subwords file format: header %q", header)
+	}
+
+	sw := subwords{
+		minN:    minN,
+		maxN:    maxN,
+		buckets: buckets,
+		vectors: make(map[uint32][]float32, min(vectors, maxPreallocate/size)),
+	}
+
+	for i := 0; i < vectors; i++ {
+		field, err := br.ReadString(' ')
+		if err != nil {
+			return fmt.Errorf("vector %d: read bucket: %w", i, err)
+		}
+
+		bucket, err := strconv.ParseUint(strings.TrimSuffix(field, " "), 10, 32)
+		if err != nil || uint32(bucket) >= buckets {
+			return fmt.Errorf("vector %d: wrong bucket %q", i, field)
+		}
+
+		vec := make([]float32, size)
+		if err := readBinaryVector(br, vec); err != nil {
+			return fmt.Errorf("vector %d: %w", i, err)
+		}
+
+		if ch, err := br.ReadByte(); err != nil || ch != '\n' {
+			return fmt.Errorf("vector %d: wrong subwords file format", i)
+		}
+
+		sw.vectors[uint32(bucket)] = vec
+	}
+
+	m.subwords = &sw
+
+	return nil
+}
+
+// SetTokenizer sets the word delimiters used to split the documents passed
+// to Embedding and Lookup, the default ones of libw2v when it's empty. Set
+// it when the model was trained with a different tokenizer, such as one
+// that keeps the words of a phrase joined.
+func (m *Model) SetTokenizer(tokenizer string) {
+	m.tokenizer = tokenizer
+}
+
+// Dim returns the number of dimensions of the word vectors.
+func (m *Model) Dim() int {
+	return m.vectorSize
+}
+
+// VocabSize returns the number of words in the model.
+func (m *Model) VocabSize() int {
+	return len(m.words)
+}
+
+// Words returns the words in the model, most frequent first when the model
+// has a vocabulary file. Words with the same frequency, and every word when
+// there is no vocabulary file, keep the order of the vectors file, which for
+// GloVe and word2vec text files is already the frequency order.
+func (m *Model) Words() []string {
+	words := make([]string, len(m.words))
+	copy(words, m.words)
+
+	if len(m.freqs) == 0 {
+		return words
+	}
+
+	sort.SliceStable(words, func(i, j int) bool {
+		return m.freqs[words[i]] > m.freqs[words[j]]
+	})
+
+	return words
+}
+
+// Frequency returns the number of times the word appeared in the training
+// data. Zero is returned when the word is unknown or the model has no
+// vocabulary file.
+func (m *Model) Frequency(word string) int {
+	return m.freqs[word]
+}
+
+// VectorOf calculates embedding vector for input term (word). When the
+// model has subword vectors, a word missing from the vocabulary gets a
+// vector composed from its character n-grams.
+func (m *Model) VectorOf(word string, vector []float32) error {
+	if err := m.checkVector(vector); err != nil {
+		return err
+	}
+
+	vec, exists := m.vector(word)
+	if !exists {
+		return errors.New("unknown tokens")
+	}
+
+	copy(vector, vec)
+
+	return nil
+}
+
+// Embedding calculates the embedding for document. It's the mean of the
+// vectors of the known words, normalized the same way as the word vectors.
+// With subword vectors, unknown words are composed from their n-grams and
+// count as well.
+func (m *Model) Embedding(doc string, vector []float32) error {
+	if err := m.checkVector(vector); err != nil {
+		return err
+	}
+
+	vec, err := m.embedding(doc)
+	if err != nil {
+		return err
+	}
+
+	copy(vector, vec)
+
+	return nil
+}
+
+// Lookup nearest words from the model. The length of seq is the number of
+// words to find. When the model has fewer neighbors, the remaining entries
+// are set to their zero value.
+func (m *Model) Lookup(query string, seq []Nearest) error {
+	if len(seq) == 0 {
+		return errors.New("nearest buffer is empty")
+	}
+
+	vec, err := m.embedding(query)
+	if err != nil {
+		return err
+	}
+
+	nearest := m.nearest(vec, len(seq))
+
+	for i := range seq {
+		seq[i] = Nearest{}
+		if i < len(nearest) {
+			seq[i] = nearest[i]
+		}
+	}
+
+	return nil
+}
+
+// LookupVector returns up to k words nearest to the vector, such as a
+// vector computed from other word vectors or a document embedding. The
+// vector is normalized the same way as the word vectors. Words in exclude
+// are left out of the result.
+func (m *Model) LookupVector(vector []float32, k int, exclude ...string) ([]Nearest, error) {
+	if err := m.checkVector(vector); err != nil {
+		return nil, err
+	}
+
+	if k <= 0 {
+		return nil, errors.New("k must be greater than zero")
+	}
+
+	vec := make([]float32, len(vector))
+	copy(vec, vector)
+
+	if err := normalize(vec); err != nil {
+		return nil, errors.New("unable to lookup a zero vector")
+	}
+
+	out := make([]Nearest, 0, k)
+
+	for _, n := range m.nearest(vec, k+len(exclude)) {
+		if len(out) == k {
+			break
+		}
+
+		if slices.Contains(exclude, n.Word) {
+			continue
+		}
+
+		out = append(out, n)
+	}
+
+	return out, nil
+}
+
+// Analogy returns up to k words nearest to the sum of the positive word
+// vectors minus the sum of the negative word vectors. The words used in the
+// query are left out of the result. For "king - man + woman", pos is
+// ["king", "woman"] and neg is ["man"].
+func (m *Model) Analogy(pos []string, neg []string, k int) ([]Nearest, error) {
+	if len(pos) == 0 {
+		return nil, errors.New("at least one positive word is required")
+	}
+
+	vector := make([]float32, m.vectorSize)
+
+	for _, w := range pos {
+		vec, exists := m.vector(w)
+		if !exists {
+			return nil, fmt.Errorf("word %q: unknown tokens", w)
+		}
+
+		for i, v := range vec {
+			vector[i] += v
+		}
+	}
+
+	for _, w := range neg {
+		vec, exists := m.vector(w)
+		if !exists {
+			return nil, fmt.Errorf("word %q: unknown tokens", w)
+		}
+
+		for i, v := range vec {
+			vector[i] -= v
+		}
+	}
+
+	exclude := make([]string, 0, len(pos)+len(neg))
+	exclude = append(exclude, pos...)
+	exclude = append(exclude, neg...)
+
+	return m.LookupVector(vector, k, exclude...)
+}
+
+// =============================================================================
+
+// wordDelimiters are the characters used by libw2v to split a document
+// into words.
+const wordDelimiters = " \n,.-!?:;/\"#$%&'()*+<=>@[]\\^_`{|}~\t\v\f\r"
+
+// maxWordLen is the longest word libw2v reads from a document.
+const maxWordLen = 100
+
+func (m *Model) checkVector(vector []float32) error {
+	if len(vector) != m.vectorSize {
+		return fmt.Errorf("vector buffer has %d elements, model has %d dimensions", len(vector), m.vectorSize)
+	}
+
+	return nil
+}
+
+// commit normalizes the vector in the last row of the matrix and adds the
+// word to the index. Later duplicates win, the same as the map used by
+// libw2v.
+func (m *Model) commit(word string) error {
+	row := len(m.matrix) - m.vectorSize
+
+	if err := normalize(m.matrix[row:]); err != nil {
+		return err
+	}
+
+	if idx, exists := m.index[word]; exists {
+		copy(m.row(idx), m.matrix[row:])
+		m.matrix = m.matrix[:row]
+		return nil
+	}
+
+	m.index[word] = len(m.words)
+	m.words = append(m.words, word)
+
+	return nil
+}
+
+func (m *Model) row(idx int) []float32 {
+	return m.matrix[idx*m.vectorSize : (idx+1)*m.vectorSize]
+}
+
+// vector returns the normalized vector of the word, composed from the
+// vectors of its character n-grams when the word isn't in the vocabulary.
+// The vector of a known word is a row of the matrix and must not be
+// changed.
+func (m *Model) vector(word string) ([]float32, bool) {
+	if idx, exists := m.index[word]; exists {
+		return m.row(idx), true
+	}
+
+	if m.subwords == nil {
+		return nil, false
+	}
+
+	vec := make([]float32, m.vectorSize)
+
+	var found bool
+	for _, bucket := range m.subwords.ngrams(word) {
+		// Buckets not used by the vocabulary were never trained.
+		bvec, exists := m.subwords.vectors[bucket]
+		if !exists {
+			continue
+		}
+
+		for i, v := range bvec {
+			vec[i] += v
+		}
+		found = true
+	}
+
+	if !found || normalize(vec) != nil {
+		return nil, false
+	}
+
+	return vec, true
+}
+
+func (m *Model) loadVocab(fileVocab string) error {
+	f, err := os.Open(fileVocab)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("open vocabulary: %w", err)
+	}
+	defer f.Close()
+
+	if err := m.ReadVocab(f); err != nil {
+		return fmt.Errorf("read vocabulary: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Model) loadSubwords(fileSubwords string) error {
+	f, err := os.Open(fileSubwords)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("open subwords: %w", err)
+	}
+	defer f.Close()
+
+	if err := m.ReadSubwords(f); err != nil {
+		return fmt.Errorf("read subwords: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Model) embedding(doc string) ([]float32, error) {
+	vec := make([]float32, m.vectorSize)
+
+	delimiters := m.tokenizer
+	if delimiters == "" {
+		delimiters = wordDelimiters
+	}
+
+	words := strings.FieldsFunc(doc, func(r rune) bool {
+		return strings.ContainsRune(delimiters, r)
+	})
+
+	for _, word := range words {
+		if len(word) > maxWordLen {
+			word = word[:maxWordLen]
+		}
+
+		wvec, exists := m.vector(word)
+		if !exists {
+			continue
+		}
+
+		for i, v := range wvec {
+			vec[i] += v
+		}
+	}
+
+	if err := normalize(vec); err != nil {
+		return nil, errors.New("unknown tokens")
+	}
+
+	return vec, nil
+}
+
+// nearest returns up to k words closest to the vector ordered by distance.
+// The distance is the one used by libw2v: the square root of the mean of
+// the products, zero when the vectors point away from each other. Exact
+// matches are skipped so a word isn't returned as its own neighbor.
+func (m *Model) nearest(vec []float32, k int) []Nearest {
+	if k <= 0 {
+		return nil
+	}
+
+	best := make([]Nearest, 0, k+1)
+
+	for idx, word := range m.words {
+		d := m.distance(vec, m.row(idx))
+		if d > 0.9999 || d <= 0 {
+			continue
+		}
+
+		if len(best) == k && d <= best[k-1].Distance {
+			continue
+		}
+
+		pos := sort.Search(len(best), func(i int) bool {
+			return best[i].Distance < d
+		})
+
+		best = append(best, Nearest{})
+		copy(best[pos+1:], best[pos:])
+		best[pos] = Nearest{Word: word, Distance: d}
+
+		if len(best) > k {
+			best = best[:k]
+		}
+	}
+
+	return best
+}
+
+func (m *Model) distance(x []float32, y []float32) float32 {
+	var dot float32
+	for i := range x {
+		dot += x[i] * y[i]
+	}
+
+	if dot <= 0 {
+		return 0
+	}
+
+	return float32(math.Sqrt(float64(dot / float32(m.vectorSize))))
+}
+
+// ngrams returns the buckets of the character n-grams of the word the same
+// way libw2v does: the word is wrapped in '<' and '>', n-grams are taken
+// over UTF-8 characters and hashed with FNV-1a.
+func (sw *subwords) ngrams(word string) []uint32 {
+	word = "<" + word + ">"
+
+	var buckets []uint32
+
+	for i := 0; i < len(word); i++ {
+		if word[i]&0xC0 == 0x80 {
+			continue
+		}
+
+		hash := uint32(2166136261)
+		j := i
+
+		for n := 1; j < len(word) && n <= sw.maxN; n++ {
+			for {
+				hash ^= uint32(word[j])
+				hash *= 16777619
+				j++
+
+				if j == len(word) || word[j]&0xC0 != 0x80 {
+					break
+				}
+			}
+
+			// A single '<' or '>' isn't an n-gram.
+			if n >= sw.minN && !(n == 1 && (i == 0 || j == len(word))) {
+				buckets = append(buckets, hash%sw.buckets)
+			}
+		}
+	}
+
+	return buckets
+}
+
+// normalize scales the vector so the mean of its squares is one, which is
+// how libw2v normalizes vectors.
+func normalize(vec []float32) error {
+	var sum float32
+	for _, v := range vec {
+		sum += v * v
+	}
+
+	if sum <= 0 {
+		return errors.New("failed to normalize vector")
+	}
+
+	med := float32(math.Sqrt(float64(sum / float32(len(vec)))))
+	for i := range vec {
+		vec[i] /= med
+	}
+
+	return nil
+}
+
+// readWord reads the word in front of a vector. The newline that ends the
+// previous record is skipped.
+func readWord(br *bufio.Reader) (string, error) {
+	var sb strings.Builder
+
+	for {
+		ch, err := br.ReadByte()
+		if err != nil {
+			return "", fmt.Errorf("read word: %w", err)
+		}
+
+		switch ch {
+		case ' ':
+			if sb.Len() == 0 {
+				continue
+			}
+			return sb.String(), nil
+
+		case '\n':
+			continue
+		}
+
+		sb.WriteByte(ch)
+	}
+}
+
+// isBinary reports whether the vector that follows is stored as raw floats.
+// A text vector is a line holding only the characters used to write numbers
+// with one value for every dimension.
+func isBinary(br *bufio.Reader, size int) (bool, error) {
+	data, err := br.Peek(br.Size())
+	if err != nil && len(data) == 0 {
+		return false, fmt.Errorf("detect format: %w", err)
+	}
+
+	line, _, found := bytes.Cut(data, []byte{'\n'})
+	if !found && len(data) == br.Size() {
+		return true, nil
+	}
+
+	for _, ch := range line {
+		if !strings.ContainsRune("0123456789.-+eE \t\r", rune(ch)) {
+			return true, nil
+		}
+	}
+
+	return len(bytes.Fields(line)) != size, nil
+}
+
+func readBinaryVector(br *bufio.Reader, vec []float32) error {
+	var buf [4]byte
+
+	for i := range vec {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return fmt.Errorf("read vector: %w", err)
+		}
+
+		bits := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16 | uint32(buf[3])<<24
+		vec[i] = math.Float32frombits(bits)
+	}
+
+	return nil
+}
+
+func readTextVector(br *bufio.Reader, vec []float32) error {
+	line, err := br.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return fmt.Errorf("read vector: %w", err)
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != len(vec) {
+		return fmt.Errorf("vector has %d values, expected %d", len(fields), len(vec))
+	}
+
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return fmt.Errorf("parse value %d: %w", i, err)
+		}
+
+		vec[i] = float32(v)
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package purego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		vector int
+		exp    map[string][]float32
+	}{
+		{
+			name: "text",
+			data: []byte("2 2\ngo 3 4\nrust -1 0\n"),
+			exp:  map[string][]float32{"go": {3, 4}, "rust": {-1, 0}},
+		},
+		{
+			name: "text without final newline",
+			data: []byte("1 3\ngo 1 2 2"),
+			exp:  map[string][]float32{"go": {1, 2, 2}},
+		},
+		{
+			name:   "binary",
+			data:   binaryModel(map[string][]float32{"go": {3, 4}, "rust": {-1, 0}}, "go", "rust"),
+			vector: 2,
+			exp:    map[string][]float32{"go": {3, 4}, "rust": {-1, 0}},
+		},
+		{
+			name: "binary value that looks like text",
+			data: binaryModel(map[string][]float32{"go": {math.Float32frombits(0x20202020), 1}}, "go"),
+			exp:  map[string][]float32{"go": {math.Float32frombits(0x20202020), 1}},
+		},
+		{
+			name: "later duplicate wins",
+			data: []byte("2 2\ngo 1 0\ngo 0 1\n"),
+			exp:  map[string][]float32{"go": {0, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Read(bytes.NewReader(tt.data), tt.vector)
+			if err != nil {
+				t.Fatalf("read: %s", err)
+			}
+
+			checkModel(t, &m, tt.exp)
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		vector int
+	}{
+		{"empty", "", 0},
+		{"header fields", "2\n", 0},
+		{"header words", "x 2\n", 0},
+		{"header size", "1 0\n", 0},
+		{"huge vector size", "1 1000000000\n", 0},
+		{"size mismatch", "1 2\ngo 1 2\n", 3},
+		{"missing vectors", "1000000000000 2\ngo 1 2\n", 0},
+		{"short vector", "2 3\ngo 1 2 3\nrust 1 2\n", 0},
+		{"zero vector", "1 2\ngo 0 0\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(tt.data), tt.vector); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadGloVe(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		vector int
+		exp    map[string][]float32
+	}{
+		{
+			name: "glove",
+			data: "go 3 4\nrust -1 0\n",
+			exp:  map[string][]float32{"go": {3, 4}, "rust": {-1, 0}},
+		},
+		{
+			name:   "blank lines and no final newline",
+			data:   "\ngo 3 4\n\nrust -1 0",
+			vector: 2,
+			exp:    map[string][]float32{"go": {3, 4}, "rust": {-1, 0}},
+		},
+		{
+			name:   "word with spaces",
+			data:   "go 1 2\nnew york 2 1\n",
+			vector: 2,
+			exp:    map[string][]float32{"go": {1, 2}, "new york": {2, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ReadGloVe(strings.NewReader(tt.data), tt.vector)
+			if err != nil {
+				t.Fatalf("read: %s", err)
+			}
+
+			checkModel(t, &m, tt.exp)
+		})
+	}
+}
+
+func TestReadGloVeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		vector int
+	}{
+		{"empty", "", 0},
+		{"blank", "\n\n", 0},
+		{"short vector", "go 1 2 3\nrust 1 2\n", 0},
+		{"size mismatch", "go 1 2\n", 3},
+		{"value", "go 1 x\n", 0},
+		{"zero vector", "go 0 0\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadGloVe(strings.NewReader(tt.data), tt.vector); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		vocab    bool
+		subwords bool
+	}{
+		{"model only", false, false},
+		{"vocabulary", true, false},
+		{"subwords", false, true},
+		{"vocabulary and subwords", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "test.model")
+			writeFile(t, file, []byte("2 2\ngo 3 4\nrust -1 0\n"))
+
+			if tt.vocab {
+				writeFile(t, file+".vocab", []byte("rust 7\ngo 5\n"))
+			}
+
+			// With a single bucket every n-gram shares the same vector.
+			if tt.subwords {
+				var buf bytes.Buffer
+				buf.WriteString("1 2 3 6 1\n0 ")
+				binary.Write(&buf, binary.LittleEndian, []float32{2, 0})
+				buf.WriteByte('\n')
+
+				writeFile(t, file+".subwords", buf.Bytes())
+			}
+
+			m, err := Load(file, 2)
+			if err != nil {
+				t.Fatalf("load: %s", err)
+			}
+
+			if exp := map[bool]int{true: 7}[tt.vocab]; m.Frequency("rust") != exp {
+				t.Fatalf("frequency: got %d, exp %d", m.Frequency("rust"), exp)
+			}
+
+			vec := make([]float32, 2)
+			err = m.VectorOf("gopher", vec)
+
+			switch {
+			case tt.subwords && err != nil:
+				t.Fatalf("vectorOf unknown word: %s", err)
+			case tt.subwords && !slices.Equal(vec, []float32{float32(math.Sqrt2), 0}):
+				t.Fatalf("vectorOf unknown word: got %v", vec)
+			case !tt.subwords && err == nil:
+				t.Fatal("vectorOf unknown word: expected an error")
+			}
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		vocab string
+		exp   []string
+	}{
+		{"file order", "", []string{"rust", "go", "zig"}},
+		{"frequency order", "go 7\nzig 5\nrust 5\n", []string{"go", "rust", "zig"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "test.model")
+			writeFile(t, file, []byte("3 2\nrust -1 0\ngo 3 4\nzig 0 1\n"))
+
+			if tt.vocab != "" {
+				writeFile(t, file+".vocab", []byte(tt.vocab))
+			}
+
+			m, err := Load(file, 2)
+			if err != nil {
+				t.Fatalf("load: %s", err)
+			}
+
+			if got := m.Words(); !slices.Equal(got, tt.exp) {
+				t.Fatalf("words: got %q, exp %q", got, tt.exp)
+			}
+		})
+	}
+}
+
+// =============================================================================
+
+func writeFile(t *testing.T, file string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatalf("write %s: %s", file, err)
+	}
+}
+
+// binaryModel returns a model in the binary format written by libw2v.
+func binaryModel(vectors map[string][]float32, words ...string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%d %d\n", len(words), len(vectors[words[0]]))
+
+	for _, word := range words {
+		buf.WriteString(word + " ")
+		binary.Write(&buf, binary.LittleEndian, vectors[word])
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// checkModel compares the words and normalized vectors of the model with
+// the expected raw vectors. The fixtures list their words in alphabetical
+// order, which is the order Words keeps without a vocabulary file.
+func checkModel(t *testing.T, m *Model, exp map[string][]float32) {
+	t.Helper()
+
+	words := make([]string, 0, len(exp))
+	for word := range exp {
+		words = append(words, word)
+	}
+	slices.Sort(words)
+
+	if got := m.Words(); !slices.Equal(got, words) {
+		t.Fatalf("words: got %q, exp %q", got, words)
+	}
+
+	got := make([]float32, m.Dim())
+
+	for word, vec := range exp {
+		if err := m.VectorOf(word, got); err != nil {
+			t.Fatalf("vectorOf %q: %s", word, err)
+		}
+
+		want := slices.Clone(vec)
+		if err := normalize(want); err != nil {
+			t.Fatalf("normalize %q: %s", word, err)
+		}
+
+		for i := range want {
+			if math.Abs(float64(got[i]-want[i])) > 1e-6 {
+				t.Fatalf("vector %q: got %v, exp %v", word, got, want)
+			}
+		}
+	}
+}
@@ -11,11 +11,21 @@ package word2vec
 /*
 #include <stdlib.h>
 #include "libw2v/include/w2v.h"
+
+extern void goParseProgress(uintptr_t handle, float percent);
+extern void goVocabularyStats(uintptr_t handle, size_t vocWords, size_t trainWords, size_t totalWords);
+extern void goTrainProgress(uintptr_t handle, float alpha, float percent);
 */
 import "C"
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"runtime"
+	"runtime/cgo"
+	"sync"
 	"unsafe"
 )
 
@@ -24,6 +34,12 @@ type ConfigCorpus struct {
 	// InputFile represents the file of the raw data to process.
 	InputFile string
 
+	// Input represents the raw data to process when InputFile is empty. It's
+	// read to the end into memory before training starts, since the trainer
+	// makes several passes over the data, and no file is written. Use
+	// SentenceReader to train from a sequence of sentences.
+	Input io.Reader
+
 	// StopWordsFile represents the file of the stopwords to use.
 	StopWordsFile string
 
@@ -68,11 +84,32 @@ type ConfigLearning struct {
 	Rate float64
 }
 
+// ConfigSubwords represents the character n-gram config items. When MinN
+// isn't zero, vectors are trained for the n-grams of every word alongside
+// the word vectors, fastText style, so words missing from the vocabulary,
+// like rare words and typos, get a vector composed from their n-grams.
+type ConfigSubwords struct {
+	// MinN represents the min length of the character n-grams.
+	// Ex: 3
+	MinN int
+
+	// MaxN represents the max length of the character n-grams.
+	// Ex: 6
+	MaxN int
+
+	// Buckets represents the number of hash buckets the n-grams share. Every
+	// bucket holds a vector while training, so it costs Buckets * Vector
+	// floats of memory.
+	// Ex: 2000000
+	Buckets int
+}
+
 // Config defines the required setting for training.
 type Config struct {
 	Corpus   ConfigCorpus
 	Vector   ConfigWordVector
 	Learning ConfigLearning
+	Subwords ConfigSubwords
 
 	// choose of the learning model:
 	//  - Continuous Bag of Words (CBOW)
@@ -92,6 +129,11 @@ type Config struct {
 	Output  string
 	Threads int
 	Verbose bool
+
+	// Progress is called with the progress of the training run. Calls are
+	// serialized, so the function doesn't need to be safe for concurrent
+	// use, but it should return quickly since the training threads wait.
+	Progress func(Progress)
 }
 
 // NewConfigDefault defines a set of default configuration options.
@@ -111,6 +153,11 @@ func NewConfigDefault() Config {
 			Epoch: 5,
 			Rate:  0.05,
 		},
+		Subwords: ConfigSubwords{
+			MinN:    0,
+			MaxN:    0,
+			Buckets: 2000000,
+		},
 		UseSkipGram:            true,
 		UseCBOW:                false,
 		UseNegativeSampling:    true,
@@ -123,8 +170,129 @@ func NewConfigDefault() Config {
 
 // =============================================================================
 
-// Train performs a training run and produces a new model.
-func Train(config Config) error {
+// Stage represents a step of a training run.
+type Stage int
+
+// Set of training stages.
+const (
+	// StageParse reports the progress of building the vocabulary from the
+	// input file.
+	StageParse Stage = iota
+
+	// StageVocabulary reports the vocabulary statistics once the input file
+	// is parsed.
+	StageVocabulary
+
+	// StageTrain reports the progress of training the word vectors.
+	StageTrain
+)
+
+// String implements the fmt.Stringer interface.
+func (s Stage) String() string {
+	switch s {
+	case StageParse:
+		return "parse"
+	case StageVocabulary:
+		return "vocabulary"
+	case StageTrain:
+		return "train"
+	}
+
+	return fmt.Sprintf("stage(%d)", int(s))
+}
+
+// Progress represents a progress event of a training run. Percent is set
+// for StageParse and StageTrain, the word counts for StageVocabulary and
+// Alpha, the current learning rate, for StageTrain.
+type Progress struct {
+	Stage      Stage
+	Percent    float64
+	VocabWords int
+	TrainWords int
+	TotalWords int
+	Alpha      float64
+}
+
+// Sentences represents a sequence of sentences to train from, such as the
+// documents from a database cursor. It calls yield for every sentence and
+// stops when yield returns false. An error stops the training run.
+type Sentences func(yield func(sentence string) bool) error
+
+// SentenceReader streams the sentences through a pipe as the raw data to
+// process, one sentence per line. Set it as ConfigCorpus.Input. The
+// sequencer must include the newline so sentences are kept apart. The
+// sentences stop when the context is done or the reader is closed, so close
+// the reader when it isn't read to the end.
+func SentenceReader(ctx context.Context, sentences Sentences) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	stop := context.AfterFunc(ctx, func() {
+		pr.CloseWithError(ctx.Err())
+	})
+
+	go func() {
+		defer stop()
+
+		err := sentences(func(sentence string) bool {
+			if _, err := io.WriteString(pw, sentence); err != nil {
+				return false
+			}
+
+			_, err := io.WriteString(pw, "\n")
+			return err == nil
+		})
+
+		pw.CloseWithError(err)
+	}()
+
+	return pr
+}
+
+// =============================================================================
+
+// Train performs a training run and returns the new model, which is also
+// written to the output file. Cancelling the context stops the training
+// threads and no model is written. Call Close when the model is no longer
+// needed.
+func Train(ctx context.Context, config Config) (*Model, error) {
+	return train(ctx, "", config)
+}
+
+// Continue trains the model in fileModel further on a new corpus and
+// returns the updated model, which is written to the output file. The
+// output can be fileModel itself. New words that appear at least
+// Vector.Frequency times are added to the vocabulary, and Learning.Epoch
+// more epochs are run over the new corpus only, starting at Learning.Rate.
+// A lower rate than the original one keeps the vectors of the existing
+// words closer to where they were, so they stay comparable.
+//
+// The vector size of the model is used, so Vector.Vector is ignored. The
+// model must have been trained by this package with negative sampling and
+// without subword vectors, since the vocabulary and output weights files
+// written next to it are required.
+func Continue(ctx context.Context, fileModel string, config Config) (*Model, error) {
+	if fileModel == "" {
+		return nil, errors.New("model file is required")
+	}
+
+	if config.UseHierarchicalSoftMax {
+		return nil, errors.New("continued training supports negative sampling only")
+	}
+
+	if config.Subwords.MinN != 0 {
+		return nil, errors.New("continued training does not support subword vectors")
+	}
+
+	return train(ctx, fileModel, config)
+}
+
+// =============================================================================
+
+func train(ctx context.Context, fileBase string, config Config) (*Model, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("train: %w", err)
+	}
+
 	w2v := struct {
 		config Config
 		h      unsafe.Pointer
@@ -132,15 +300,52 @@ func Train(config Config) error {
 		config: config,
 	}
 
+	if sw := w2v.config.Subwords; sw.MinN != 0 {
+		if sw.MinN < 0 || sw.MaxN < sw.MinN || sw.MaxN > 0xFF {
+			return nil, fmt.Errorf("invalid character n-gram lengths %d to %d", sw.MinN, sw.MaxN)
+		}
+
+		if sw.Buckets <= 0 || sw.Buckets > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid number of n-gram buckets %d", sw.Buckets)
+		}
+	}
+
+	var data []byte
+
+	if w2v.config.Corpus.InputFile == "" {
+		if w2v.config.Corpus.Input == nil {
+			return nil, errors.New("input file or input reader is required")
+		}
+
+		var err error
+		data, err = readInput(ctx, w2v.config.Corpus.Input)
+		if err != nil {
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("train: %w", err)
+			}
+			return nil, fmt.Errorf("readInput: %w", err)
+		}
+	}
+
 	dataset := C.CString(w2v.config.Corpus.InputFile)
 	defer C.free(unsafe.Pointer(dataset))
 
+	// The trainer only reads the data for the duration of the call, so the
+	// Go memory is passed as is.
+	var trainData *C.char
+	if len(data) > 0 {
+		trainData = (*C.char)(unsafe.Pointer(&data[0]))
+	}
+
 	fileStopWords := C.CString(w2v.config.Corpus.StopWordsFile)
 	defer C.free(unsafe.Pointer(fileStopWords))
 
 	fileModel := C.CString(w2v.config.Output)
 	defer C.free(unsafe.Pointer(fileModel))
 
+	base := C.CString(fileBase)
+	defer C.free(unsafe.Pointer(base))
+
 	withHS := C.uchar(0)
 	if w2v.config.UseHierarchicalSoftMax {
 		withHS = C.uchar(1)
@@ -162,8 +367,47 @@ func Train(config Config) error {
 		verbose = C.uchar(1)
 	}
 
+	job := C.NewJob()
+	defer C.FreeJob(job)
+
+	var progress C.struct_progress_t
+	if w2v.config.Progress != nil {
+		handle := cgo.NewHandle(&progressReporter{report: w2v.config.Progress})
+		defer handle.Delete()
+
+		progress = C.struct_progress_t{
+			handle: C.uintptr_t(handle),
+			parse:  C.parseProgress_t(C.goParseProgress),
+			stats:  C.vocabularyStats_t(C.goVocabularyStats),
+			train:  C.trainProgress_t(C.goTrainProgress),
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			C.CancelJob(job)
+		case <-done:
+		}
+	}()
+
+	// The goroutine is joined before the job is freed, it can be cancelling
+	// the job when Train returns.
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
 	w2v.h = C.Train(
 		dataset,
+		trainData,
+		C.size_t(len(data)),
+		base,
 		fileStopWords,
 		fileModel,
 		C.ushort(w2v.config.Vector.Frequency),
@@ -176,14 +420,105 @@ func Train(config Config) error {
 		C.uint8_t(w2v.config.Learning.Epoch),
 		C.float(w2v.config.Learning.Rate),
 		withSG,
+		C.uint8_t(w2v.config.Subwords.MinN),
+		C.uint8_t(w2v.config.Subwords.MaxN),
+		C.uint32_t(w2v.config.Subwords.Buckets),
 		tokenizer,
 		sequencer,
 		verbose,
+		job,
+		progress,
 	)
 
 	if uintptr(w2v.h) == 0 {
-		return fmt.Errorf("unable to train model")
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("train: %w", err)
+		}
+		return nil, errors.New("unable to train model")
+	}
+
+	m, err := newModel(w2v.config.Output, w2v.h, 0)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	m.tokenizer = w2v.config.Corpus.Tokenizer
+
+	return m, nil
+}
+
+// readInput reads the input into memory for the trainer to pass over several
+// times. When the context is done first, it stops waiting on the reader,
+// which is left to the caller to close.
+func readInput(ctx context.Context, input io.Reader) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	ch := make(chan result, 1)
+
+	go func() {
+		data, err := io.ReadAll(input)
+		ch <- result{data: data, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+
+	case res := <-ch:
+		switch {
+		case res.err != nil:
+			return nil, fmt.Errorf("read input: %w", res.err)
+		case len(res.data) == 0:
+			return nil, errors.New("input is empty")
+		}
+
+		return res.data, nil
+	}
+}
+
+// progressReporter serializes the progress events coming from the training
+// threads.
+type progressReporter struct {
+	mu     sync.Mutex
+	report func(Progress)
+}
+
+func (pr *progressReporter) send(p Progress) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	pr.report(p)
+}
+
+//export goParseProgress
+func goParseProgress(handle C.uintptr_t, percent C.float) {
+	pr := cgo.Handle(handle).Value().(*progressReporter)
+	pr.send(Progress{
+		Stage:   StageParse,
+		Percent: float64(percent),
+	})
+}
+
+//export goVocabularyStats
+func goVocabularyStats(handle C.uintptr_t, vocWords C.size_t, trainWords C.size_t, totalWords C.size_t) {
+	pr := cgo.Handle(handle).Value().(*progressReporter)
+	pr.send(Progress{
+		Stage:      StageVocabulary,
+		VocabWords: int(vocWords),
+		TrainWords: int(trainWords),
+		TotalWords: int(totalWords),
+	})
+}
+
+//export goTrainProgress
+func goTrainProgress(handle C.uintptr_t, alpha C.float, percent C.float) {
+	pr := cgo.Handle(handle).Value().(*progressReporter)
+	pr.send(Progress{
+		Stage:   StageTrain,
+		Percent: float64(percent),
+		Alpha:   float64(alpha),
+	})
 }
@@ -18,9 +18,16 @@ import "C"
 import (
 	"errors"
 	"fmt"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
 	"unsafe"
 )
 
+// ErrClosed is returned when a model is used after it was closed.
+var ErrClosed = errors.New("model is closed")
+
 // Nearest represents the word and the percent of closeness.
 type Nearest struct {
 	Word     string
@@ -29,34 +36,118 @@ type Nearest struct {
 
 // =============================================================================
 
-// Model represents a word2vec model.
+// Model represents a word2vec model. The model holds memory allocated by
+// the C++ library that is released by Close. A model is safe for concurrent
+// use by multiple goroutines: VectorOf, Embedding and Lookup only read the
+// model, and Close waits for the calls in progress to finish.
 type Model struct {
 	fileModel  string
 	vectorSize int
-	h          unsafe.Pointer
+	vocabSize  int
+	words      []string
+
+	mu        sync.RWMutex
+	h         unsafe.Pointer
+	tokenizer string
 }
 
-// Loads takes a file on disk and loads it for processing.
-func Load(fileModel string, vector int) (w2v Model, err error) {
-	w2v.fileModel = fileModel
-	w2v.vectorSize = 300
-	if vector != 0 {
-		w2v.vectorSize = vector
+// Loads takes a file on disk and loads it for processing. The vector size
+// and vocabulary size are read from the model file. When vector isn't zero,
+// it must match the vector size of the model. The vocabulary and subword
+// files written next to the model by Train are loaded when they exist. Call
+// Close when the model is no longer needed.
+func Load(fileModel string, vector int) (*Model, error) {
+	name := C.CString(fileModel)
+	defer C.free(unsafe.Pointer(name))
+
+	h := C.Load(name)
+	if uintptr(h) == 0 {
+		return nil, fmt.Errorf("unable to load model")
 	}
 
-	name := C.CString(w2v.fileModel)
-	defer C.free(unsafe.Pointer(name))
+	return newModel(fileModel, h, vector)
+}
+
+// Close releases the memory held by the model. Calls made after Close
+// return ErrClosed. Close can be called more than once. A finalizer closes
+// models that are garbage collected without being closed, but memory is
+// only returned promptly by calling Close.
+func (m *Model) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.h == nil {
+		return nil
+	}
+
+	C.Free(m.h)
+	m.h = nil
+
+	runtime.SetFinalizer(m, nil)
+
+	return nil
+}
+
+// SetTokenizer sets the word delimiters used to split the documents passed
+// to Embedding and Lookup. A model returned by Train uses the tokenizer it
+// was trained with and a loaded model uses the default one, so set it when
+// the model was trained with a different tokenizer, such as one that keeps
+// the words of a phrase joined.
+func (m *Model) SetTokenizer(tokenizer string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	w2v.h = C.Load(name)
-	if uintptr(w2v.h) == 0 {
-		return w2v, fmt.Errorf("unable to load model")
+	m.tokenizer = tokenizer
+}
+
+// Dim returns the number of dimensions of the word vectors.
+func (m *Model) Dim() int {
+	return m.vectorSize
+}
+
+// VocabSize returns the number of words in the model.
+func (m *Model) VocabSize() int {
+	return m.vocabSize
+}
+
+// Words returns the words in the model, most frequent first when the model
+// has a vocabulary file and in alphabetical order otherwise.
+func (m *Model) Words() []string {
+	words := make([]string, len(m.words))
+	copy(words, m.words)
+
+	return words
+}
+
+// Frequency returns the number of times the word appeared in the training
+// data. Zero is returned when the word is unknown or the model has no
+// vocabulary file, which is written next to the model by Train.
+func (m *Model) Frequency(word string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.h == nil {
+		return 0
 	}
 
-	return w2v, nil
+	return m.frequency(word)
 }
 
-// VectorOf calculates embedding vector for input term (word)
+// VectorOf calculates embedding vector for input term (word). When the
+// model was trained with subword vectors, a word missing from the
+// vocabulary gets a vector composed from its character n-grams.
 func (m *Model) VectorOf(word string, vector []float32) error {
+	if err := m.checkVector(vector); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.h == nil {
+		return ErrClosed
+	}
+
 	cword := C.CString(word)
 	defer C.free(unsafe.Pointer(cword))
 
@@ -74,12 +165,28 @@ func (m *Model) VectorOf(word string, vector []float32) error {
 	return nil
 }
 
-// Embedding calculates the embedding for document.
+// Embedding calculates the embedding for document. Unknown words are left
+// out, unless the model was trained with subword vectors and composes them
+// from their character n-grams, so misspelled words still count.
 func (m *Model) Embedding(doc string, vector []float32) error {
+	if err := m.checkVector(vector); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.h == nil {
+		return ErrClosed
+	}
+
 	cdoc := C.CString(doc)
 	defer C.free(unsafe.Pointer(cdoc))
 
-	ptr := C.Embedding(m.h, cdoc)
+	delimiters := m.delimiters()
+	defer C.free(unsafe.Pointer(delimiters))
+
+	ptr := C.Embedding(m.h, cdoc, delimiters)
 	if ptr == nil {
 		return errors.New("unknown tokens")
 	}
@@ -93,36 +200,238 @@ func (m *Model) Embedding(doc string, vector []float32) error {
 	return nil
 }
 
-// Lookup nearest words from the model
+// Lookup nearest words from the model. The length of seq is the number of
+// words to find. When the model has fewer neighbors, the remaining entries
+// are set to their zero value.
 func (m *Model) Lookup(query string, seq []Nearest) error {
-	cq := C.CString(query)
-	defer C.free(unsafe.Pointer(cq))
+	if len(seq) == 0 {
+		return errors.New("nearest buffer is empty")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	type nearest_t struct {
-		seq *C.float
-		len C.ulong
-		buf *C.char
+	if m.h == nil {
+		return ErrClosed
 	}
 
+	cq := C.CString(query)
+	defer C.free(unsafe.Pointer(cq))
+
 	k := len(seq)
-	bag := (nearest_t)(C.Lookup(m.h, cq, C.ulong(k)))
+	delimiters := m.delimiters()
+	defer C.free(unsafe.Pointer(delimiters))
+
+	bag := C.Lookup(m.h, cq, C.size_t(k), delimiters)
 
 	if bag.seq == nil || bag.buf == nil {
 		return errors.New("unknown tokens")
 	}
 
-	seqd := unsafe.Slice((*float32)(bag.seq), k)
+	nearest := decodeNearest(bag)
+
+	for i := 0; i < k; i++ {
+		seq[i] = Nearest{}
+		if i < len(nearest) {
+			seq[i] = nearest[i]
+		}
+	}
+
+	return nil
+}
+
+// LookupVector returns up to k words nearest to the vector, such as a
+// vector computed from other word vectors or a document embedding. The
+// vector is normalized the same way as the word vectors. Words in exclude
+// are left out of the result.
+func (m *Model) LookupVector(vector []float32, k int, exclude ...string) ([]Nearest, error) {
+	if err := m.checkVector(vector); err != nil {
+		return nil, err
+	}
+
+	if k <= 0 {
+		return nil, errors.New("k must be greater than zero")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.h == nil {
+		return nil, ErrClosed
+	}
+
+	bag := C.LookupVector(m.h, (*C.float)(unsafe.Pointer(&vector[0])), C.size_t(k+len(exclude)))
+	if bag.seq == nil || bag.buf == nil {
+		return nil, errors.New("unable to lookup a zero vector")
+	}
+
+	return excludeNearest(decodeNearest(bag), k, exclude), nil
+}
+
+// Analogy returns up to k words nearest to the sum of the positive word
+// vectors minus the sum of the negative word vectors. The words used in the
+// query are left out of the result. For "king - man + woman", pos is
+// ["king", "woman"] and neg is ["man"].
+func (m *Model) Analogy(pos []string, neg []string, k int) ([]Nearest, error) {
+	if len(pos) == 0 {
+		return nil, errors.New("at least one positive word is required")
+	}
+
+	vector := make([]float32, m.vectorSize)
+	word := make([]float32, m.vectorSize)
+
+	for _, w := range pos {
+		if err := m.VectorOf(w, word); err != nil {
+			return nil, fmt.Errorf("word %q: %w", w, err)
+		}
+
+		for i, v := range word {
+			vector[i] += v
+		}
+	}
+
+	for _, w := range neg {
+		if err := m.VectorOf(w, word); err != nil {
+			return nil, fmt.Errorf("word %q: %w", w, err)
+		}
+
+		for i, v := range word {
+			vector[i] -= v
+		}
+	}
+
+	exclude := make([]string, 0, len(pos)+len(neg))
+	exclude = append(exclude, pos...)
+	exclude = append(exclude, neg...)
+
+	return m.LookupVector(vector, k, exclude...)
+}
+
+// =============================================================================
+
+// newModel wraps a model handle returned by the C++ library. The handle is
+// freed when the model can't be constructed.
+func newModel(fileModel string, h unsafe.Pointer, vector int) (*Model, error) {
+	m := Model{
+		fileModel:  fileModel,
+		vectorSize: int(C.VectorSize(h)),
+		vocabSize:  int(C.ModelSize(h)),
+		h:          h,
+	}
+
+	if vector != 0 && vector != m.vectorSize {
+		C.Free(h)
+		return nil, fmt.Errorf("model vector size is %d, not %d", m.vectorSize, vector)
+	}
+
+	words, err := m.loadWords()
+	if err != nil {
+		C.Free(h)
+		return nil, err
+	}
+
+	m.words = words
+
+	runtime.SetFinalizer(&m, func(m *Model) {
+		m.Close()
+	})
+
+	return &m, nil
+}
+
+// delimiters returns the tokenizer as a C string for the caller to free, or
+// nil to use the default delimiters of libw2v.
+func (m *Model) delimiters() *C.char {
+	if m.tokenizer == "" {
+		return nil
+	}
+
+	return C.CString(m.tokenizer)
+}
+
+func (m *Model) frequency(word string) int {
+	cword := C.CString(word)
+	defer C.free(unsafe.Pointer(cword))
+
+	return int(C.Frequency(m.h, cword))
+}
+
+// decodeNearest copies the nearest words returned by the C++ library and
+// frees its memory.
+func decodeNearest(bag C.struct_nearest_t) []Nearest {
+	defer C.free(unsafe.Pointer(bag.seq))
+	defer C.free(unsafe.Pointer(bag.buf))
+
+	n := int(bag.count)
+	seqd := unsafe.Slice((*float32)(bag.seq), n)
 	seqw := unsafe.Slice((*C.char)(bag.buf), bag.len)
 
+	nearest := make([]Nearest, n)
+
 	p := 0
-	for i := 0; i < k; i++ {
-		seq[i].Distance = seqd[i]
-		seq[i].Word = C.GoString(&seqw[p])
-		p += len(seq[i].Word) + 1
+	for i := range nearest {
+		nearest[i].Distance = seqd[i]
+		nearest[i].Word = C.GoString(&seqw[p])
+		p += len(nearest[i].Word) + 1
+	}
+
+	return nearest
+}
+
+// excludeNearest removes the excluded words and keeps up to k words.
+func excludeNearest(nearest []Nearest, k int, exclude []string) []Nearest {
+	out := make([]Nearest, 0, k)
+
+	for _, n := range nearest {
+		if len(out) == k {
+			break
+		}
+
+		if slices.Contains(exclude, n.Word) {
+			continue
+		}
+
+		out = append(out, n)
 	}
 
-	C.free(unsafe.Pointer(bag.seq))
-	C.free(unsafe.Pointer(bag.buf))
+	return out
+}
+
+func (m *Model) checkVector(vector []float32) error {
+	if len(vector) != m.vectorSize {
+		return fmt.Errorf("vector buffer has %d elements, model has %d dimensions", len(vector), m.vectorSize)
+	}
 
 	return nil
 }
+
+func (m *Model) loadWords() ([]string, error) {
+	bag := C.Words(m.h)
+	if bag.buf == nil && bag.count > 0 {
+		return nil, errors.New("unable to read words")
+	}
+	defer C.free(unsafe.Pointer(bag.buf))
+
+	n := int(bag.count)
+	buf := unsafe.Slice((*C.char)(bag.buf), bag.len)
+
+	words := make([]string, n)
+	freqs := make(map[string]int, n)
+
+	p := 0
+	for i := 0; i < n; i++ {
+		words[i] = C.GoString(&buf[p])
+		p += len(words[i]) + 1
+
+		freqs[words[i]] = m.frequency(words[i])
+	}
+
+	sort.Slice(words, func(i, j int) bool {
+		if freqs[words[i]] != freqs[words[j]] {
+			return freqs[words[i]] > freqs[words[j]]
+		}
+		return words[i] < words[j]
+	})
+
+	return words, nil
+}